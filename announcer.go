@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Collects short session summaries for group chats. First summary opens
+// a window, everything arrived during it is posted as one message.
+type Announcer struct {
+	mu      sync.Mutex
+	window  time.Duration
+	pending map[int64][]Announcement
+}
+
+// Session of a single player, several sessions during one window are summed
+type Announcement struct {
+	User      User
+	Diff      Report
+	QuickWins int
+}
+
+func NewAnnouncer(window time.Duration) *Announcer {
+	return &Announcer{
+		window:  window,
+		pending: make(map[int64][]Announcement),
+	}
+}
+
+// Window can be overridden by ANNOUNCE_WINDOW env variable
+func NewAnnouncerFromEnv() *Announcer {
+	window := 10 * time.Minute
+	if env := os.Getenv("ANNOUNCE_WINDOW"); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil {
+			log.Fatalf("ANNOUNCE_WINDOW env variable is wrong: %s", err)
+		}
+		window = d
+	}
+
+	return NewAnnouncer(window)
+}
+
+func (a *Announcer) Add(chat int64, announcement Announcement) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pending, ok := a.pending[chat]
+	if !ok {
+		time.AfterFunc(a.window, func() {
+			a.Flush(chat)
+		})
+	}
+
+	// Profile may be refreshed more than once during window
+	for i, old := range pending {
+		if old.User.Id == announcement.User.Id {
+			pending[i] = Announcement{
+				User: announcement.User,
+				Diff: Report{
+					Rating: old.Diff.Rating + announcement.Diff.Rating,
+					Games:  old.Diff.Games + announcement.Diff.Games,
+					Wins:   old.Diff.Wins + announcement.Diff.Wins,
+					Ties:   old.Diff.Ties + announcement.Diff.Ties,
+					Losses: old.Diff.Losses + announcement.Diff.Losses,
+				},
+				QuickWins: old.QuickWins + announcement.QuickWins,
+			}
+			return
+		}
+	}
+	a.pending[chat] = append(pending, announcement)
+}
+
+func (a *Announcer) Flush(chat int64) {
+	a.mu.Lock()
+	pending := a.pending[chat]
+	delete(a.pending, chat)
+	a.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	log.Infof("announcing %d sessions to %d", len(pending), chat)
+
+	var lines []string
+	for _, announcement := range pending {
+		lines = append(lines, MakeAnnouncement(announcement.User, announcement.Diff, announcement.QuickWins))
+	}
+
+	msg := tgbotapi.NewMessage(chat, "<b>Sessions:</b>\n"+strings.Join(lines, "\n"))
+	msg.ParseMode = "HTML"
+	bot.Send(msg)
+}
+
+// One line like "Alice +75 SR, 4-1-0"
+func MakeAnnouncement(user User, diff Report, quickWins int) string {
+	text := fmt.Sprintf("<b>%s</b>", DisplayNick(user))
+	if diff.Games > 0 || diff.Rating != 0 {
+		text += fmt.Sprintf(" %+d SR, %d-%d-%d", diff.Rating, diff.Wins, diff.Losses, diff.Ties)
+	}
+	if quickWins > 0 {
+		text += fmt.Sprintf(" (+%d Quick Play wins)", quickWins)
+	}
+
+	return text
+}
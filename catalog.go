@@ -0,0 +1,454 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/sdwolfe32/ovrstat/ovrstat"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Heroes, their roles and stats shown by /h_, adding a hero is a change
+// of this file only
+//
+//go:embed heroes.json
+var heroCatalogData []byte
+
+var catalog *HeroCatalog
+
+// Career stats groups a stat spec may point to, see CareerGroup
+var careerGroups = []string{"Assists", "Average", "Best", "Combat", "Deaths", "HeroSpecific", "Game", "MatchAwards", "Miscellaneous"}
+
+// Groups scanned by RenderOther for stats the catalog doesn't describe
+var otherGroups = []string{"HeroSpecific", "Combat", "Assists", "Miscellaneous"}
+
+// Aggregates of counters, e.g. "enemiesSleptMostInGame", logged when unknown
+// but not shown since the counter itself is
+var aggregateSuffixes = []string{"MostInGame", "MostInLife", "AvgPer10Min", "Avg", "Average"}
+
+// Parts of keys of values that are not counters, shown without per minute rate
+var ratioParts = []string{"Accuracy", "Percentage", "PerLife", "Ratio"}
+
+// Unknown stats are logged once per process, not on every /h_
+var loggedStats sync.Map
+
+// Letters users type without diacritics, e.g. "lucio" for "lúcio"
+var diacritics = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ö", "o", "ú", "u", "ü", "u")
+
+// How many hero suggestions are shown for ambiguous input
+const heroSuggestionsLimit = 5
+
+type StatSpec struct {
+	Group string `json:"group"`
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	// Divide counter by minutes played on hero
+	PerMinute bool    `json:"per_minute"`
+	Scale     float64 `json:"scale"`
+	// Printf format for the number, "%s" prints value as is, e.g. "45%"
+	Format string `json:"format"`
+	// Add place among other players
+	Rank bool `json:"rank"`
+}
+
+type HeroSpec struct {
+	// Key in ovrstat TopHeroes and CareerStats
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Nicknames accepted besides key and name, e.g. "hog" for Roadhog
+	Aliases []string   `json:"aliases"`
+	Stats   []StatSpec `json:"stats"`
+}
+
+type HeroCatalog struct {
+	// Stats shown for every hero before hero specific ones
+	Common []StatSpec `json:"common"`
+	// Known keys intentionally not shown
+	Hidden []string    `json:"hidden"`
+	Heroes []*HeroSpec `json:"heroes"`
+	byKey  map[string]*HeroSpec
+	// Normalized key, name and aliases to key
+	byName map[string]string
+}
+
+func LoadHeroCatalog(data []byte) (*HeroCatalog, error) {
+	var c HeroCatalog
+	err := json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("catalog: %s", err)
+	}
+
+	for i, spec := range c.Common {
+		if err := spec.validate(); err != nil {
+			return nil, fmt.Errorf("catalog: common stat %d: %s", i, err)
+		}
+	}
+
+	for i, key := range c.Hidden {
+		if key == "" {
+			return nil, fmt.Errorf("catalog: hidden key %d is empty", i)
+		}
+	}
+
+	c.byKey = make(map[string]*HeroSpec)
+	c.byName = make(map[string]string)
+	for i, hero := range c.Heroes {
+		if hero.Key == "" || hero.Name == "" {
+			return nil, fmt.Errorf("catalog: hero %d has no key or name", i)
+		}
+		if _, ok := c.byKey[hero.Key]; ok {
+			return nil, fmt.Errorf("catalog: hero %s listed twice", hero.Key)
+		}
+		if !IsRole(hero.Role) {
+			return nil, fmt.Errorf("catalog: hero %s has wrong role %q", hero.Key, hero.Role)
+		}
+
+		for j, spec := range hero.Stats {
+			if err := spec.validate(); err != nil {
+				return nil, fmt.Errorf("catalog: hero %s stat %d: %s", hero.Key, j, err)
+			}
+		}
+
+		for _, name := range append([]string{hero.Key, hero.Name}, hero.Aliases...) {
+			normalized := normalizeHero(name)
+			if normalized == "" {
+				return nil, fmt.Errorf("catalog: hero %s has empty alias", hero.Key)
+			}
+			if other, ok := c.byName[normalized]; ok && other != hero.Key {
+				return nil, fmt.Errorf("catalog: %q is used by %s and %s", name, other, hero.Key)
+			}
+			c.byName[normalized] = hero.Key
+		}
+
+		c.byKey[hero.Key] = hero
+	}
+
+	return &c, nil
+}
+
+func (spec StatSpec) validate() error {
+	if !contains(careerGroups, spec.Group) {
+		return fmt.Errorf("wrong group %q", spec.Group)
+	}
+	if spec.Key == "" || spec.Label == "" {
+		return fmt.Errorf("no key or label")
+	}
+
+	// Exactly one verb, "%%" is a literal percent sign
+	verbs := strings.Count(spec.Format, "%") - 2*strings.Count(spec.Format, "%%")
+	if verbs != 1 {
+		return fmt.Errorf("format %q should have a single verb", spec.Format)
+	}
+	if strings.Contains(spec.Format, "%s") && (spec.PerMinute || spec.Scale != 0) {
+		return fmt.Errorf("%s can't be computed with %%s format", spec.Key)
+	}
+
+	return nil
+}
+
+func (c *HeroCatalog) Hero(key string) (*HeroSpec, bool) {
+	hero, ok := c.byKey[key]
+	return hero, ok
+}
+
+// Display name, e.g. "D.Va" for "dVa"
+func (c *HeroCatalog) Name(key string) string {
+	if hero, ok := c.byKey[key]; ok {
+		return hero.Name
+	}
+
+	return strings.Title(strings.ToLower(key))
+}
+
+// Empty for heroes missing in catalog
+func (c *HeroCatalog) Role(key string) string {
+	if hero, ok := c.byKey[key]; ok {
+		return hero.Role
+	}
+
+	return ""
+}
+
+// Line like "<b>0.50</b> enemies slept per min" without line break,
+// false when player has no such stat
+func (spec StatSpec) Render(stats ovrstat.StatsCollection, hero string) (string, bool) {
+	value, ok := CareerGroup(stats, hero, spec.Group)[spec.Key]
+	if !ok {
+		return "", false
+	}
+
+	if strings.Contains(spec.Format, "%s") {
+		return fmt.Sprintf("<b>"+spec.Format+"</b> %s", fmt.Sprint(value), spec.Label), true
+	}
+
+	number, ok := NumberValue(value)
+	if !ok {
+		return "", false
+	}
+
+	if spec.PerMinute {
+		minutes := float64(TimePlayed(stats, hero)) / 60
+		if minutes == 0 {
+			return "", false
+		}
+		number /= minutes
+	}
+	if spec.Scale != 0 {
+		number *= spec.Scale
+	}
+
+	return fmt.Sprintf("<b>"+spec.Format+"</b> %s", number, spec.Label), true
+}
+
+// Key of hero user typed, e.g. "soldier76" for "soldier" or "Soldier: 76".
+// Exact key, name or alias wins, then unique prefix, then the closest
+// names by edit distance. Ambiguous input gives keys to suggest instead.
+func (c *HeroCatalog) Resolve(input string) (key string, suggestions []string) {
+	name := normalizeHero(input)
+	if name == "" {
+		return "", nil
+	}
+
+	if key, ok := c.byName[name]; ok {
+		return key, nil
+	}
+
+	var prefixed []string
+	for known, key := range c.byName {
+		if len(name) >= 2 && strings.HasPrefix(known, name) && !contains(prefixed, key) {
+			prefixed = append(prefixed, key)
+		}
+	}
+	if len(prefixed) == 1 {
+		return prefixed[0], nil
+	}
+	if len(prefixed) > 1 {
+		return "", c.suggestions(prefixed)
+	}
+
+	// Typos, one edit for short names and two for longer
+	maxDistance := 1
+	if len([]rune(name)) > 4 {
+		maxDistance = 2
+	}
+
+	var closest []string
+	best := maxDistance + 1
+	for known, key := range c.byName {
+		distance := levenshtein(known, name)
+		if distance < best {
+			best, closest = distance, nil
+		}
+		if distance == best && !contains(closest, key) {
+			closest = append(closest, key)
+		}
+	}
+	if best > maxDistance {
+		return "", nil
+	}
+	if len(closest) == 1 {
+		return closest[0], nil
+	}
+
+	return "", c.suggestions(closest)
+}
+
+// Resolved key or input as is, heroes missing in catalog are typed by key
+func (c *HeroCatalog) Key(input string) string {
+	if key, _ := c.Resolve(input); key != "" {
+		return key
+	}
+
+	return input
+}
+
+// Keys in catalog order, so suggestions don't shuffle between calls
+func (c *HeroCatalog) suggestions(keys []string) []string {
+	var ordered []string
+	for _, hero := range c.Heroes {
+		if contains(keys, hero.Key) && len(ordered) < heroSuggestionsLimit {
+			ordered = append(ordered, hero.Key)
+		}
+	}
+
+	return ordered
+}
+
+// Lowercase letters and digits only, e.g. "soldier76" for "Soldier: 76"
+func normalizeHero(name string) string {
+	name = diacritics.Replace(strings.ToLower(name))
+
+	return strings.Map(func(char rune) rune {
+		if unicode.IsLetter(char) || unicode.IsDigit(char) {
+			return char
+		}
+		return -1
+	}, name)
+}
+
+func levenshtein(a string, b string) int {
+	left, right := []rune(a), []rune(b)
+
+	previous := make([]int, len(right)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(left); i++ {
+		current := make([]int, len(right)+1)
+		current[0] = i
+		for j := 1; j <= len(right); j++ {
+			cost := 1
+			if left[i-1] == right[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+
+	return previous[len(right)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+
+	return min
+}
+
+// Stat is shown by a spec or hidden on purpose
+func (c *HeroCatalog) Known(hero string, group string, key string) bool {
+	if contains(c.Hidden, key) {
+		return true
+	}
+
+	specs := c.Common
+	if heroSpec, ok := c.byKey[hero]; ok {
+		specs = append(append([]StatSpec{}, specs...), heroSpec.Stats...)
+	}
+	for _, spec := range specs {
+		if spec.Group == group && spec.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Lines for every numeric stat missing in catalog, so new heroes and
+// stats are shown before anyone curates them. Counters are divided by
+// minutes played on hero. Every missing key is logged once.
+func (c *HeroCatalog) RenderOther(stats ovrstat.StatsCollection, hero string) []string {
+	minutes := float64(TimePlayed(stats, hero)) / 60
+
+	var lines []string
+	for _, group := range otherGroups {
+		values := CareerGroup(stats, hero, group)
+
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if c.Known(hero, group, key) {
+				continue
+			}
+
+			// Aggregates are logged for curation too, but not shown
+			// next to the counter they are computed from
+			line, ok := "", false
+			if !isAggregate(key) {
+				line, ok = renderGeneric(key, values[key], minutes)
+			}
+			if ok {
+				lines = append(lines, line)
+			}
+
+			if _, logged := loggedStats.LoadOrStore(hero+"/"+group+"/"+key, true); !logged {
+				log.WithFields(logrus.Fields{"hero": hero, "group": group, "key": key, "shown": ok}).Info("stat missing in hero catalog")
+			}
+		}
+	}
+
+	return lines
+}
+
+func renderGeneric(key string, value interface{}, minutes float64) (string, bool) {
+	label := Humanize(key)
+
+	// Percentages as is, other strings are durations like "01:02:03"
+	if text, ok := value.(string); ok {
+		if _, ok := NumberValue(text); !ok || !strings.HasSuffix(text, "%") {
+			return "", false
+		}
+		return fmt.Sprintf("<b>%s</b> %s", text, label), true
+	}
+
+	number, ok := NumberValue(value)
+	if !ok {
+		return "", false
+	}
+
+	if isRatio(key) {
+		return fmt.Sprintf("<b>%0.2f</b> %s", number, label), true
+	}
+	if minutes == 0 {
+		return fmt.Sprintf("<b>%0.0f</b> %s", number, label), true
+	}
+
+	return fmt.Sprintf("<b>%0.2f</b> %s per min", number/minutes, label), true
+}
+
+func isAggregate(key string) bool {
+	for _, suffix := range aggregateSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isRatio(key string) bool {
+	for _, part := range ratioParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Readable label of camelCase key, e.g. "enemies slept" for "enemiesSlept"
+func Humanize(key string) string {
+	var words []string
+	var word []rune
+	for i, char := range key {
+		startsWord := unicode.IsUpper(char)
+		if i > 0 && unicode.IsDigit(char) != unicode.IsDigit(rune(key[i-1])) {
+			startsWord = true
+		}
+		if startsWord && len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+		word = append(word, unicode.ToLower(char))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+
+	return strings.Join(words, " ")
+}
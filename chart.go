@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"time"
+)
+
+const (
+	chartWidth  = 800
+	chartHeight = 400
+	chartLeft   = 50
+	chartRight  = 15
+	chartTop    = 30
+	chartBottom = 30
+)
+
+var (
+	chartBackground = color.RGBA{0x1e, 0x22, 0x2a, 0xff}
+	chartGrid       = color.RGBA{0x3a, 0x3f, 0x4b, 0xff}
+	chartText       = color.RGBA{0xd0, 0xd4, 0xdc, 0xff}
+	chartSeason     = color.RGBA{0x8a, 0x8f, 0x9b, 0xff}
+	chartWin        = color.RGBA{0x4c, 0xaf, 0x50, 0xff}
+	chartLoss       = color.RGBA{0xe5, 0x39, 0x35, 0xff}
+	// Line colors for each player, single player chart uses the first one
+	chartPalette = []color.RGBA{
+		{0xf9, 0x9e, 0x1a, 0xff},
+		{0x21, 0x96, 0xf3, 0xff},
+		{0xab, 0x47, 0xbc, 0xff},
+		{0x26, 0xc6, 0xda, 0xff},
+		{0xff, 0xee, 0x58, 0xff},
+		{0xec, 0x40, 0x7a, 0xff},
+		{0x9c, 0xcc, 0x65, 0xff},
+		{0xff, 0x70, 0x43, 0xff},
+	}
+)
+
+type ChartSeries struct {
+	Name      string
+	Snapshots []Snapshot
+}
+
+type chart struct {
+	img      *image.RGBA
+	from, to time.Time
+	low      int
+	high     int
+}
+
+// Draw SR over time as PNG. Season boundaries are shown as vertical lines,
+// with single series every point is also marked as won or lost.
+func RenderChart(title string, series []ChartSeries) ([]byte, error) {
+	c := &chart{img: image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))}
+	draw.Draw(c.img, c.img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	c.bounds(series)
+	c.grid()
+	c.text(chartLeft, chartTop-10, title, chartText)
+
+	for i, s := range series {
+		lineColor := chartPalette[i%len(chartPalette)]
+
+		var prevX, prevY int
+		for j, snapshot := range s.Snapshots {
+			if j > 0 && snapshot.Games < s.Snapshots[j-1].Games {
+				c.dashedLine(c.x(snapshot.Date), chartSeason)
+			}
+
+			// Unplaced player has no SR
+			if snapshot.Rating == 0 {
+				prevX = 0
+				continue
+			}
+
+			x, y := c.x(snapshot.Date), c.y(snapshot.Rating)
+			if prevX != 0 {
+				c.line(prevX, prevY, x, y, lineColor)
+			}
+			prevX, prevY = x, y
+		}
+
+		if len(series) == 1 {
+			c.markers(s.Snapshots)
+		} else {
+			c.legend(i, s.Name, lineColor)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, c.img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *chart) bounds(series []ChartSeries) {
+	for _, s := range series {
+		for _, snapshot := range s.Snapshots {
+			if c.from.IsZero() || snapshot.Date.Before(c.from) {
+				c.from = snapshot.Date
+			}
+			if snapshot.Date.After(c.to) {
+				c.to = snapshot.Date
+			}
+
+			if snapshot.Rating == 0 {
+				continue
+			}
+			if c.low == 0 || snapshot.Rating < c.low {
+				c.low = snapshot.Rating
+			}
+			if snapshot.Rating > c.high {
+				c.high = snapshot.Rating
+			}
+		}
+	}
+
+	// Round to whole hundreds with some room around the line
+	c.low = (c.low - 50) / 100 * 100
+	if c.low < 0 {
+		c.low = 0
+	}
+	c.high = (c.high + 149) / 100 * 100
+}
+
+func (c *chart) x(date time.Time) int {
+	width := chartWidth - chartLeft - chartRight
+	if !c.to.After(c.from) {
+		return chartLeft + width/2
+	}
+
+	return chartLeft + int(float64(width)*float64(date.Sub(c.from))/float64(c.to.Sub(c.from)))
+}
+
+func (c *chart) y(rating int) int {
+	height := chartHeight - chartTop - chartBottom
+	return chartTop + height - int(float64(height)*float64(rating-c.low)/float64(c.high-c.low))
+}
+
+func (c *chart) grid() {
+	// No more than 8 horizontal lines
+	step := 100
+	for (c.high-c.low)/step > 8 {
+		step += 100
+	}
+
+	for rating := c.low; rating <= c.high; rating += step {
+		y := c.y(rating)
+		c.line(chartLeft, y, chartWidth-chartRight, y, chartGrid)
+		c.text(5, y+4, strconv.Itoa(rating), chartText)
+	}
+
+	for i := 0; i <= 4; i++ {
+		date := c.from.Add(c.to.Sub(c.from) * time.Duration(i) / 4)
+		c.text(c.x(date)-17, chartHeight-10, date.Format("02.01"), chartText)
+		if !c.to.After(c.from) {
+			break
+		}
+	}
+}
+
+// Green dot when session had more wins than losses, red when less
+func (c *chart) markers(snapshots []Snapshot) {
+	for i := 1; i < len(snapshots); i++ {
+		prev, snapshot := snapshots[i-1], snapshots[i]
+		if snapshot.Rating == 0 || snapshot.Games < prev.Games {
+			continue
+		}
+
+		var markerColor color.RGBA
+		switch balance := (snapshot.Wins - prev.Wins) - (snapshot.Losses - prev.Losses); {
+		case balance > 0:
+			markerColor = chartWin
+		case balance < 0:
+			markerColor = chartLoss
+		default:
+			continue
+		}
+
+		c.dot(c.x(snapshot.Date), c.y(snapshot.Rating), markerColor)
+	}
+}
+
+func (c *chart) legend(i int, name string, legendColor color.RGBA) {
+	x, y := chartWidth-chartRight-150, chartTop+10+i*15
+	for dx := 0; dx < 12; dx++ {
+		c.dot(x+dx, y-4, legendColor)
+	}
+	c.text(x+18, y, name, chartText)
+}
+
+func (c *chart) text(x int, y int, text string, textColor color.RGBA) {
+	d := font.Drawer{
+		Dst:  c.img,
+		Src:  &image.Uniform{textColor},
+		Face: basicfont.Face7x13,
+		Dot:  fixed.Point26_6{X: fixed.I(x), Y: fixed.I(y)},
+	}
+	d.DrawString(text)
+}
+
+// Bresenham's line, two pixels wide
+func (c *chart) line(x0 int, y0 int, x1 int, y1 int, lineColor color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	err := dx + dy
+	for {
+		c.img.Set(x0, y0, lineColor)
+		c.img.Set(x0, y0+1, lineColor)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func (c *chart) dashedLine(x int, lineColor color.RGBA) {
+	for y := chartTop; y < chartHeight-chartBottom; y++ {
+		if y/4%2 == 0 {
+			c.img.Set(x, y, lineColor)
+		}
+	}
+}
+
+func (c *chart) dot(x int, y int, dotColor color.RGBA) {
+	for dx := -3; dx <= 3; dx++ {
+		for dy := -3; dy <= 3; dy++ {
+			if dx*dx+dy*dy <= 9 {
+				c.img.Set(x+dx, y+dy, dotColor)
+			}
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
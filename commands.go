@@ -3,27 +3,32 @@ package main
 import (
 	"fmt"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"html"
+	"sort"
 	"strings"
+	"time"
 )
 
-func StartCommand(update tgbotapi.Update) {
+func StartCommand(update tgbotapi.Update, args []string) {
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Simple bot for Overwatch by @kraso\n\n"+
 		"<b>How to use:</b>\n"+
 		"1. Use /save to save your game profile.\n"+
 		"2. Use /me to see your stats.\n"+
 		"3. ???\n"+
 		"4. PROFIT!\n\n"+
-		"<b>Features:</b>\n"+
-		"— Player profile (/me command)\n"+
-		"— Small summary for heroes\n"+
-		"— Reports after every game session\n")
+		"<b>Commands:</b>\n"+
+		router.Help(PrivateChat)+"\n"+
+		"<b>In groups:</b>\n"+
+		router.Help(GroupChat)+"\n"+
+		"Reports are sent after every game session.\n\n"+
+		"Share stats in any chat: <code>@"+bot.UserName()+" me</code>, <code>h ana</code> or <code>top</code>.")
 	msg.ParseMode = "HTML"
 	bot.Send(msg)
 
 	log.Info("/start command executed successful")
 }
 
-func DonateCommand(update tgbotapi.Update) {
+func DonateCommand(update tgbotapi.Update, args []string) {
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "If you find this bot helpful, "+
 		"<a href=\"https://paypal.me/krasovsky\">you can make small donation</a> to help me pay server bills!")
 	msg.ParseMode = "HTML"
@@ -32,55 +37,45 @@ func DonateCommand(update tgbotapi.Update) {
 	log.Info("donate command executed successful")
 }
 
-type Hero struct {
-	Name                string
-	TimePlayedInSeconds int
-}
-
-type Heroes []Hero
-
-func (hero Heroes) Len() int {
-	return len(hero)
-}
-
-func (hero Heroes) Less(i, j int) bool {
-	return hero[i].TimePlayedInSeconds < hero[j].TimePlayedInSeconds
-}
-
-func (hero Heroes) Swap(i, j int) {
-	hero[i], hero[j] = hero[j], hero[i]
-}
+func SaveCommand(update tgbotapi.Update, args []string) {
+	region, nick := strings.ToLower(args[0]), args[1]
+	if !IsConsole(region) {
+		nick = strings.Replace(nick, "#", "-", -1)
+	}
 
-func SaveCommand(update tgbotapi.Update) {
-	info := strings.Split(update.Message.Text, " ")
 	var text string
 
-	if len(info) == 3 {
-		if info[1] != "psn" && info[1] != "xbl" {
-			info[2] = strings.Replace(info[2], "#", "-", -1)
+	profile, err := GetOverwatchProfile(region, nick)
+	if err != nil {
+		log.Warn(err)
+		text = "Player not found!"
+	} else {
+		id := fmt.Sprint(dbPKPrefix, update.Message.From.ID)
+
+		// Keep primary chat, settings and patreon badge when profile is re-saved
+		old, err := store.GetUser(id)
+		if err != nil && err != ErrNotFound {
+			log.Warn(err)
+			return
 		}
 
-		profile, err := GetOverwatchProfile(info[1], info[2])
+		err = store.InsertUser(User{
+			Id:       id,
+			Profile:  profile,
+			Region:   region,
+			Nick:     nick,
+			Chat:     old.Chat,
+			Settings: old.Settings,
+			Username: update.Message.From.UserName,
+			Patreon:  old.Patreon,
+		})
 		if err != nil {
 			log.Warn(err)
-			text = "Player not found!"
-		} else {
-			_, err := InsertUser(User{
-				Id:      fmt.Sprint(dbPKPrefix, update.Message.From.ID),
-				Profile: profile,
-				Region:  info[1],
-				Nick:    info[2],
-			})
-			if err != nil {
-				log.Warn(err)
-				return
-			}
-
-			log.Info("/save command executed successful")
-			text = "Saved!"
+			return
 		}
-	} else {
-		text = "<b>Example:</b> <code>/save eu|us|kr|psn|xbl BattleTag#1337|ConsoleLogin</code>"
+
+		log.Info("/save command executed successful")
+		text = "Saved!"
 	}
 
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
@@ -88,14 +83,14 @@ func SaveCommand(update tgbotapi.Update) {
 	bot.Send(msg)
 }
 
-func MeCommand(update tgbotapi.Update) {
-	user, err := GetUser(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
+func MeCommand(update tgbotapi.Update, args []string) {
+	user, err := store.GetUser(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
 	if err != nil {
 		log.Warn(err)
 		return
 	}
 
-	place, err := GetRatingPlace(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
+	place, regionPlace, err := GetRatingPlaces(user)
 	if err != nil {
 		log.Warn(err)
 		return
@@ -104,12 +99,12 @@ func MeCommand(update tgbotapi.Update) {
 	log.Info("/me command executed successful")
 
 	var text string
-	info := strings.Split(update.Message.Text, "_")
-
-	if len(info) == 1 {
-		text = MakeSummary(user, place, "CompetitiveStats")
-	} else if len(info) == 2 && info[1] == "quick" {
-		text = MakeSummary(user, place, "QuickPlayStats")
+	if len(args) == 0 {
+		text = MakeSummary(user, place, regionPlace, "CompetitiveStats")
+	} else if args[0] == "quick" {
+		text = MakeSummary(user, place, regionPlace, "QuickPlayStats")
+	} else {
+		text = "<b>Example:</b> <code>/me_quick</code>"
 	}
 
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
@@ -117,8 +112,23 @@ func MeCommand(update tgbotapi.Update) {
 	bot.Send(msg)
 }
 
-func HeroCommand(update tgbotapi.Update) {
-	user, err := GetUser(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
+// Places on platform and in region, zero place is shown as not ranked
+func GetRatingPlaces(user User) (Ranking, Ranking, error) {
+	place, err := store.GetRatingPlace(user.Id, "")
+	if err != nil && err != ErrNotFound {
+		return Ranking{}, Ranking{}, err
+	}
+
+	regionPlace, err := store.GetRatingPlace(user.Id, user.Region)
+	if err != nil && err != ErrNotFound {
+		return Ranking{}, Ranking{}, err
+	}
+
+	return place, regionPlace, nil
+}
+
+func HeroCommand(update tgbotapi.Update, args []string) {
+	user, err := store.GetUser(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
 	if err != nil {
 		log.Warn(err)
 		return
@@ -127,12 +137,18 @@ func HeroCommand(update tgbotapi.Update) {
 	log.Info("/h_ command executed successful")
 
 	var text string
-	info := strings.Split(update.Message.Text, "_")
-	hero := info[1]
+	hero, suggestions := catalog.Resolve(args[0])
+	if hero == "" {
+		hero = args[0]
+	}
 
-	if len(info) == 2 {
+	if len(args) == 2 && args[1] != "quick" {
+		text = fmt.Sprintf("<b>Example:</b> <code>/h_%s_quick</code>", html.EscapeString(hero))
+	} else if len(suggestions) > 0 {
+		text = MakeHeroSuggestions(suggestions, len(args) == 2)
+	} else if len(args) == 1 {
 		text = MakeHeroSummary(hero, "CompetitiveStats", user)
-	} else if len(info) == 3 && info[2] == "quick" {
+	} else {
 		text = MakeHeroSummary(hero, "QuickPlayStats", user)
 	}
 
@@ -141,7 +157,7 @@ func HeroCommand(update tgbotapi.Update) {
 	bot.Send(msg)
 }
 
-func RatingTopCommand(update tgbotapi.Update, platform string) {
+func RatingTopCommand(update tgbotapi.Update, platform string, args []string) {
 	var chatId int64
 	if update.Message.Chat.Type == "private" {
 		chatId = 0
@@ -149,38 +165,37 @@ func RatingTopCommand(update tgbotapi.Update, platform string) {
 		chatId = update.Message.Chat.ID
 	}
 
-	top, err := GetRatingTop(platform, 20, chatId)
+	var role string
+	if len(args) > 0 {
+		role = strings.ToLower(args[0])
+		if !IsRole(role) {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("<b>Roles:</b> <code>%s</code>", strings.Join(roles, "|")))
+			msg.ParseMode = "HTML"
+			bot.Send(msg)
+			return
+		}
+	}
+
+	top, more, err := GetRatingTopPage(platform, role, chatId, 0)
 	if err != nil {
 		log.Warn(err)
 		return
 	}
 
-	text := "<b>Rating Top:</b>\n"
-	for i, elem := range top {
-		nick := elem.Patreon + elem.Nick
-		if elem.Region != "psn" && elem.Region != "xbl" {
-			nick = strings.Replace(nick, "-", "#", -1)
-		}
-		text += fmt.Sprintf("%d. %s (%d)\n", i+1, nick, elem.Profile.Rating)
-	}
-	if len(top) == 0 {
-		text += "It's empty..."
-	}
-
-	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, MakeRatingTopText(platform, role, 0, top))
 	msg.ParseMode = "HTML"
+	if keyboard := MakeRatingTopKeyboard(platform, role, 0, more); keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
 	bot.Send(msg)
 }
 
-func SetChatCommand(update tgbotapi.Update) {
-	// Skip if it's private
-	if update.Message.Chat.Type == "private" {
-		return
-	}
-
-	res, err := UpdateUser(User{
-		Id:   fmt.Sprint("tg:", update.Message.From.ID),
-		Chat: update.Message.Chat.ID,
+func SetChatCommand(update tgbotapi.Update, args []string) {
+	// Username may have changed since /save, /vs looks users up by it
+	changed, err := store.UpdateUser(User{
+		Id:       fmt.Sprint("tg:", update.Message.From.ID),
+		Chat:     update.Message.Chat.ID,
+		Username: update.Message.From.UserName,
 	})
 	if err != nil {
 		log.Warn(err)
@@ -188,14 +203,127 @@ func SetChatCommand(update tgbotapi.Update) {
 	}
 
 	var text string
-	if res.Unchanged != 0 {
+	if changed {
+		text = "<b>Done:</b> Set as primary chat!"
+	} else {
 		text = "<b>Error:</b> This chat already set as primary!"
 	}
-	if res.Replaced != 0 || res.Updated != 0 {
-		text = "<b>Done:</b> Set as primary chat!"
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	msg.ParseMode = "HTML"
+	bot.Send(msg)
+}
+
+func HistoryCommand(update tgbotapi.Update, args []string) {
+	id := fmt.Sprint(dbPKPrefix, update.Message.From.ID)
+	period := "7d"
+	if len(args) == 1 {
+		period = strings.ToLower(args[0])
+	}
+
+	var text string
+
+	_, err := store.GetUser(id)
+	if err == ErrNotFound {
+		text = "Save your profile with /save first."
+	} else if err != nil {
+		log.Warn(err)
+		text = "<b>Error:</b> Can't load your profile, try again later."
+	} else {
+		snapshots, err := GetPeriodSnapshots(id, period, time.Now())
+		if err == errWrongPeriod {
+			text = "<b>Example:</b> <code>/history 7d|30d|season</code>"
+		} else if err != nil {
+			log.Warn(err)
+			text = "<b>Error:</b> Can't load your history, try again later."
+		} else if len(snapshots) < 2 {
+			text = "No history for this period yet. It's recorded every time your profile is refreshed, check back later!"
+		} else {
+			log.Info("/history command executed successful")
+			text = MakeHistorySummary(period, NewProgression(snapshots))
+		}
 	}
 
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
 	msg.ParseMode = "HTML"
 	bot.Send(msg)
 }
+
+func ChartCommand(update tgbotapi.Update, args []string) {
+	period := "30d"
+	if len(args) == 1 {
+		period = strings.ToLower(args[0])
+	}
+
+	var users []User
+	if update.Message.Chat.IsPrivate() {
+		user, err := store.GetUser(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
+		if err == ErrNotFound {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Save your profile with /save first.")
+			bot.Send(msg)
+			return
+		}
+		if err != nil {
+			log.Warn(err)
+			return
+		}
+		users = append(users, user)
+	} else {
+		chatUsers, err := store.GetChatUsers(update.Message.Chat.ID)
+		if err != nil {
+			log.Warn(err)
+			return
+		}
+
+		for _, user := range chatUsers {
+			if user.Profile != nil {
+				users = append(users, user)
+			}
+		}
+
+		// Keep the chart readable, one color per player
+		sort.Slice(users, func(i, j int) bool {
+			return users[i].Profile.Rating > users[j].Profile.Rating
+		})
+		if len(users) > len(chartPalette) {
+			users = users[:len(chartPalette)]
+		}
+	}
+
+	var series []ChartSeries
+	for _, user := range users {
+		snapshots, err := GetPeriodSnapshots(user.Id, period, time.Now())
+		if err == errWrongPeriod {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "<b>Example:</b> <code>/chart 7d|30d|season</code>")
+			msg.ParseMode = "HTML"
+			bot.Send(msg)
+			return
+		}
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+		if len(snapshots) == 0 {
+			continue
+		}
+
+		series = append(series, ChartSeries{Name: DisplayNick(user), Snapshots: snapshots})
+	}
+
+	if len(series) == 0 {
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "No history for this period yet. It's recorded every time a profile is refreshed, check back later!")
+		bot.Send(msg)
+		return
+	}
+
+	data, err := RenderChart(fmt.Sprintf("SR history (%s)", period), series)
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	log.Info("/chart command executed successful")
+
+	photo := tgbotapi.NewPhotoUpload(update.Message.Chat.ID, tgbotapi.FileBytes{Name: "chart.png", Bytes: data})
+	bot.Send(photo)
+}
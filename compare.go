@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/sdwolfe32/ovrstat/ovrstat"
+	"html"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How many heroes played by both are compared in /vs
+const sharedHeroesLimit = 5
+
+// Line like "Rating:\n<code>3100 ◀️ 2900</code>", arrow points to the leader
+func AddCompareString(name string, left float64, right float64, format string) string {
+	arrow := "="
+	if left > right {
+		arrow = "◀️"
+	} else if right > left {
+		arrow = "▶️"
+	}
+
+	return fmt.Sprintf("%s:\n<code>%s %s %s</code>\n", name, fmt.Sprintf(format, left), arrow, fmt.Sprintf(format, right))
+}
+
+// Heroes played by both players, most played first
+func SharedHeroes(left ovrstat.StatsCollection, right ovrstat.StatsCollection) []string {
+	var heroes []string
+	for name, hero := range left.TopHeroes {
+		if other, ok := right.TopHeroes[name]; ok && hero != nil && other != nil && hero.TimePlayedInSeconds > 0 && other.TimePlayedInSeconds > 0 {
+			heroes = append(heroes, name)
+		}
+	}
+
+	sort.Slice(heroes, func(i, j int) bool {
+		return TimePlayed(left, heroes[i])+TimePlayed(right, heroes[i]) > TimePlayed(left, heroes[j])+TimePlayed(right, heroes[j])
+	})
+
+	return heroes
+}
+
+func MakeComparison(left User, right User) string {
+	text := fmt.Sprintf("<b>%s</b> vs <b>%s</b>\n\n", DisplayNick(left), DisplayNick(right))
+
+	leftStats, rightStats := left.Profile.CompetitiveStats, right.Profile.CompetitiveStats
+	leftReport, rightReport := BasicStats(leftStats), BasicStats(rightStats)
+
+	text += AddCompareString("Rating", float64(left.Profile.Rating), float64(right.Profile.Rating), "%0.0f")
+	if leftReport.Games > 0 && rightReport.Games > 0 {
+		text += AddCompareString(
+			"Winrate",
+			float64(leftReport.Wins)/float64(leftReport.Games)*100,
+			float64(rightReport.Wins)/float64(rightReport.Games)*100,
+			"%0.2f%%",
+		)
+	}
+
+	leftKD, leftOk := KDRatio(leftStats)
+	rightKD, rightOk := KDRatio(rightStats)
+	if leftOk && rightOk {
+		text += AddCompareString("K/D", leftKD, rightKD, "%0.2f")
+	}
+
+	heroes := SharedHeroes(leftStats, rightStats)
+	if len(heroes) > sharedHeroesLimit {
+		heroes = heroes[:sharedHeroesLimit]
+	}
+	if len(heroes) > 0 {
+		text += "\n<b>Shared heroes:</b>\n"
+	}
+
+	for _, hero := range heroes {
+		leftHero, rightHero := leftStats.TopHeroes[hero], rightStats.TopHeroes[hero]
+		text += fmt.Sprintf("<b>%s</b> (%s | %s)\n", catalog.Name(hero), leftHero.TimePlayed, rightHero.TimePlayed)
+		text += AddCompareString("Winrate", float64(leftHero.WinPercentage), float64(rightHero.WinPercentage), "%0.0f%%")
+
+		leftKD, leftOk := NumberValue(CareerGroup(leftStats, hero, "Combat")["eliminationsPerLife"])
+		rightKD, rightOk := NumberValue(CareerGroup(rightStats, hero, "Combat")["eliminationsPerLife"])
+		if leftOk && rightOk {
+			text += AddCompareString("K/D", leftKD, rightKD, "%0.2f")
+		}
+	}
+
+	return text
+}
+
+// User mentioned as @username, with a text mention or by BattleTag name.
+// In groups only members who made it their primary chat with /setchat
+// are looked up.
+func FindMentionedUser(update tgbotapi.Update, mention string) (User, error) {
+	var (
+		users []User
+		err   error
+	)
+	if update.Message.Chat.IsPrivate() {
+		users, err = store.GetUsers()
+	} else {
+		users, err = store.GetChatUsers(update.Message.Chat.ID)
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	// Users without username are mentioned by id
+	var mentionedId string
+	if update.Message.Entities != nil {
+		for _, entity := range *update.Message.Entities {
+			if entity.Type == "text_mention" && entity.User != nil {
+				mentionedId = fmt.Sprint(dbPKPrefix, entity.User.ID)
+			}
+		}
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(mention, "@"))
+	for _, user := range users {
+		if user.Profile == nil {
+			continue
+		}
+
+		if user.Id == mentionedId {
+			return user, nil
+		}
+		// Bare "@" must not match users without username
+		if name == "" {
+			continue
+		}
+		if strings.ToLower(user.Username) == name {
+			return user, nil
+		}
+		if battleTag := strings.Split(DisplayNick(user), "#")[0]; strings.ToLower(battleTag) == name {
+			return user, nil
+		}
+	}
+
+	return User{}, ErrNotFound
+}
+
+func VsCommand(update tgbotapi.Update, args []string) {
+	user, err := store.GetUser(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
+	if err == ErrNotFound {
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Save your profile with /save first.")
+		bot.Send(msg)
+		return
+	}
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	var (
+		other User
+		text  string
+	)
+	if len(args) == 1 {
+		other, err = FindMentionedUser(update, args[0])
+		if err == ErrNotFound {
+			text = "Player not found! They should /save profile and /setchat in this group."
+		} else if err != nil {
+			log.Warn(err)
+			return
+		}
+	} else {
+		region, nick := strings.ToLower(args[0]), args[1]
+		if !IsConsole(region) {
+			nick = strings.Replace(nick, "#", "-", -1)
+		}
+
+		profile, err := GetOverwatchProfile(region, nick)
+		if err != nil {
+			log.Warn(err)
+			text = "Player not found!"
+		} else {
+			other = User{Profile: profile, Nick: nick, Region: region}
+		}
+	}
+
+	if text == "" {
+		log.Info("/vs command executed successful")
+		text = MakeComparison(user, other)
+	}
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	msg.ParseMode = "HTML"
+	bot.Send(msg)
+}
+
+// Metrics of /hcompare in order, names from topStats
+var heroCompareStats = []string{"winrate", "elims", "damage", "healing", "blocked", "objectives", "crits"}
+
+// Line like "Winrate:\n<code>55% (top 10%) ◀️ 50% (top 30%)</code>"
+func AddRankedCompareString(name string, left float64, right float64, leftRank Ranking, rightRank Ranking, format string) string {
+	arrow := "="
+	if left > right {
+		arrow = "◀️"
+	} else if right > left {
+		arrow = "▶️"
+	}
+
+	leftText, rightText := fmt.Sprintf(format, left), fmt.Sprintf(format, right)
+	if leftRank.Place != 0 {
+		leftText += fmt.Sprintf(" (top %0.0f%%)", leftRank.Percentile)
+	}
+	if rightRank.Place != 0 {
+		rightText += fmt.Sprintf(" (top %0.0f%%)", rightRank.Percentile)
+	}
+
+	return fmt.Sprintf("%s:\n<code>%s %s %s</code>\n", name, leftText, arrow, rightText)
+}
+
+func MakeHeroComparison(user User, left string, right string, mode string) (string, error) {
+	stats := ModeStats(user.Profile, mode)
+	for _, hero := range []string{left, right} {
+		if heroStats, ok := stats.TopHeroes[hero]; !ok || heroStats == nil {
+			return fmt.Sprintf("No stats for <b>%s</b>, check /me for hero names.", html.EscapeString(hero)), nil
+		}
+	}
+
+	users, err := GetTopCandidates(PlatformOf(user.Region), "", 0)
+	if err != nil {
+		return "", err
+	}
+
+	// Same population as store.GetRank, so /h_ shows the same places
+	maxAge, now := RankingMaxAgeFromEnv(), time.Now()
+	var candidates []User
+	for _, candidate := range users {
+		if IsRanked(candidate, maxAge, now) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	ranked := IsRanked(user, maxAge, now)
+
+	text := fmt.Sprintf("<b>%s</b> vs <b>%s</b>\n", catalog.Name(left), catalog.Name(right))
+	text += fmt.Sprintf("<code>%s | %s</code>\n\n", stats.TopHeroes[left].TimePlayed, stats.TopHeroes[right].TimePlayed)
+
+	for _, name := range heroCompareStats {
+		stat, _ := FindTopStat(name)
+
+		// Shown for any playtime, only ranking has the threshold
+		leftValue, leftOk := stat.RawValue(stats, left)
+		rightValue, rightOk := stat.RawValue(stats, right)
+		if !leftOk && !rightOk {
+			continue
+		}
+
+		var leftRank, rightRank Ranking
+		if ranked {
+			leftRank, err = StatRanking(stat, left, mode, user, candidates)
+			if err != nil && err != ErrNotFound {
+				return "", err
+			}
+			rightRank, err = StatRanking(stat, right, mode, user, candidates)
+			if err != nil && err != ErrNotFound {
+				return "", err
+			}
+		}
+
+		text += AddRankedCompareString(strings.ToUpper(stat.Title[:1])+stat.Title[1:], leftValue, rightValue, leftRank, rightRank, stat.Format)
+	}
+
+	text += fmt.Sprintf("\nRanks are among players with %0.0f+ minutes on hero.", minHeroTimePlayed.Minutes())
+
+	return text, nil
+}
+
+func HeroCompareCommand(update tgbotapi.Update, args []string) {
+	user, err := store.GetUser(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
+	if err == ErrNotFound {
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Save your profile with /save first.")
+		bot.Send(msg)
+		return
+	}
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	mode := "CompetitiveStats"
+	if len(args) == 3 {
+		if args[2] != "quick" {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("<b>Example:</b> <code>/hcompare %s %s quick</code>", html.EscapeString(args[0]), html.EscapeString(args[1])))
+			msg.ParseMode = "HTML"
+			bot.Send(msg)
+			return
+		}
+		mode = "QuickPlayStats"
+	}
+
+	text, err := MakeHeroComparison(user, catalog.Key(args[0]), catalog.Key(args[1]), mode)
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	log.Info("/hcompare command executed successful")
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	msg.ParseMode = "HTML"
+	bot.Send(msg)
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
-	"errors"
 	r "gopkg.in/gorethink/gorethink.v3"
 	"os"
+	"time"
 )
 
-func InitConnectionPool() {
-	var err error
+type RethinkStore struct {
+	session *r.Session
+	maxAge  time.Duration
+}
 
+func NewRethinkStore() *RethinkStore {
 	dbUrl := os.Getenv("DB")
 	if dbUrl == "" {
 		log.Fatal("DB env variable not specified")
@@ -19,7 +22,7 @@ func InitConnectionPool() {
 		log.Fatal("DBPASS env variable not specified")
 	}
 
-	session, err = r.Connect(r.ConnectOpts{
+	session, err := r.Connect(r.ConnectOpts{
 		Address:    dbUrl,
 		InitialCap: 10,
 		MaxOpen:    10,
@@ -30,21 +33,103 @@ func InitConnectionPool() {
 		log.Fatal(err)
 	}
 
-	res, err := r.Table("users").Filter(func(user r.Term) r.Term {
-		return user.Field("id").Match("^tg")
-	}).Changes().Run(session)
+	store := &RethinkStore{session: session, maxAge: RankingMaxAgeFromEnv()}
+	err = store.migrate()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var change Change
-	for res.Next(&change) {
-		SessionReport(change)
+	return store
+}
+
+// Tables and secondary indexes created on startup if missing
+var rethinkTables = []string{"users", "history", "chats"}
+
+var rethinkIndexes = []struct {
+	table string
+	name  string
+	fn    func(row r.Term) interface{}
+}{
+	{"history", "user_date", func(row r.Term) interface{} {
+		return []interface{}{row.Field("user"), row.Field("date")}
+	}},
+	{"history", "date", func(row r.Term) interface{} {
+		return row.Field("date")
+	}},
+	{"users", "rating", func(row r.Term) interface{} {
+		return row.Field("profile").Field("Rating")
+	}},
+	{"users", "region_rating", func(row r.Term) interface{} {
+		return []interface{}{row.Field("region"), row.Field("profile").Field("Rating")}
+	}},
+}
+
+func (s *RethinkStore) migrate() error {
+	var tables []string
+	err := r.TableList().ReadAll(&tables, s.session)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range rethinkTables {
+		if contains(tables, table) {
+			continue
+		}
+
+		log.Infof("db: creating table %s", table)
+		err = r.TableCreate(table).Exec(s.session)
+		if err != nil {
+			return err
+		}
 	}
+
+	for _, index := range rethinkIndexes {
+		var indexes []string
+		err = r.Table(index.table).IndexList().ReadAll(&indexes, s.session)
+		if err != nil {
+			return err
+		}
+		if contains(indexes, index.name) {
+			continue
+		}
+
+		log.Infof("db: creating index %s.%s", index.table, index.name)
+		err = r.Table(index.table).IndexCreateFunc(index.name, index.fn).Exec(s.session)
+		if err != nil {
+			return err
+		}
+
+		err = r.Table(index.table).IndexWait(index.name).Exec(s.session)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func GetUser(id string) (User, error) {
-	res, err := r.Table("users").Get(id).Run(session)
+func (s *RethinkStore) WatchProfiles(handler func(Change)) error {
+	res, err := r.Table("users").Filter(func(user r.Term) r.Term {
+		return user.Field("id").Match("^tg")
+	}).Changes().Run(s.session)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var change Change
+		for res.Next(&change) {
+			handler(change)
+		}
+
+		log.Warn("changefeed closed: ", res.Err())
+	}()
+
+	return nil
+}
+
+func (s *RethinkStore) GetUser(id string) (User, error) {
+	res, err := r.Table("users").Get(id).Run(s.session)
 	if err != nil {
 		return User{}, err
 	}
@@ -52,7 +137,7 @@ func GetUser(id string) (User, error) {
 	var user User
 	err = res.One(&user)
 	if err == r.ErrEmptyResult {
-		return User{}, errors.New("db: row not found")
+		return User{}, ErrNotFound
 	}
 	if err != nil {
 		return User{}, err
@@ -62,23 +147,49 @@ func GetUser(id string) (User, error) {
 	return user, nil
 }
 
-func GetRatingTop(platform string, limit int, chat int64) ([]User, error) {
+func (s *RethinkStore) GetUsers() ([]User, error) {
+	res, err := r.Table("users").Filter(func(user r.Term) r.Term {
+		return user.Field("id").Match("^" + dbPKPrefix)
+	}).Run(s.session)
+	if err != nil {
+		return []User{}, err
+	}
+
+	var users []User
+	err = res.All(&users)
+	if err != nil {
+		return []User{}, err
+	}
+
+	defer res.Close()
+	return users, nil
+}
+
+func (s *RethinkStore) GetChatUsers(chat int64) ([]User, error) {
+	res, err := r.Table("users").Filter(r.Row.Field("chat").Eq(chat)).Run(s.session)
+	if err != nil {
+		return []User{}, err
+	}
+
+	var users []User
+	err = res.All(&users)
+	if err != nil {
+		return []User{}, err
+	}
+
+	defer res.Close()
+	return users, nil
+}
+
+func (s *RethinkStore) GetRatingTop(platform string, role string, offset int, limit int, chat int64) ([]User, error) {
 	var (
 		res *r.Cursor
 		err error
 	)
 
-	query := r.Table("users").OrderBy(r.OrderByOpts{Index: r.Desc("rating")})
-	if platform == "console" {
-		query = query.Filter(r.Row.Field("region").Eq("psn").Or(r.Row.Field("region").Eq("xbl")))
-	} else {
-		query = query.Filter(r.Row.Field("region").Ne("psn").And(r.Row.Field("region").Ne("xbl")))
-	}
-	if chat != 0 {
-		query = query.Filter(r.Row.Field("chat").Eq(chat))
-	}
+	query := s.ratingTop(platform, role, chat)
 
-	res, err = query.Limit(limit).Run(session)
+	res, err = query.Skip(offset).Limit(limit).Run(s.session)
 
 	if err != nil {
 		return []User{}, err
@@ -94,83 +205,311 @@ func GetRatingTop(platform string, limit int, chat int64) ([]User, error) {
 	return top, nil
 }
 
-func GetRatingPlace(id string) (Top, error) {
-	res, err := r.Do(
-		r.Table("users").OrderBy(r.OrderByOpts{Index: r.Desc("rating")}).OffsetsOf(r.Row.Field("id").Eq(id)).Nth(0),
-		r.Table("users").Count(),
-		func(place r.Term, count r.Term) r.Term {
-			return r.Expr(
-				map[string]interface{}{
-					"place": place.Add(1),
-					"rank":  place.Div(count).Mul(100),
-				},
-			)
-		},
-	).Run(session)
+func (s *RethinkStore) GetRatingTopOffset(id string, platform string, role string, chat int64) (int, error) {
+	query := s.ratingTop(platform, role, chat)
 
-	var top Top
-	err = res.One(&top)
+	res, err := query.OffsetsOf(r.Row.Field("id").Eq(id)).Nth(0).Default(-1).Run(s.session)
 	if err != nil {
-		log.Warn(err)
-		return Top{}, err
+		return 0, err
 	}
 
-	return top, nil
+	var offset int
+	err = res.One(&offset)
+	if err != nil {
+		return 0, err
+	}
+	if offset == -1 {
+		return 0, ErrNotFound
+	}
+
+	defer res.Close()
+	return offset, nil
+}
+
+// Users of platform ordered by rating in descending, platform is "pc",
+// "console" or a single region
+func (s *RethinkStore) byRating(platform string) r.Term {
+	switch platform {
+	case "pc":
+		return r.Table("users").OrderBy(r.OrderByOpts{Index: r.Desc("rating")}).
+			Filter(r.Row.Field("region").Ne("psn").And(r.Row.Field("region").Ne("xbl")))
+	case "console":
+		return r.Table("users").OrderBy(r.OrderByOpts{Index: r.Desc("rating")}).
+			Filter(r.Row.Field("region").Eq("psn").Or(r.Row.Field("region").Eq("xbl")))
+	}
+
+	return r.Table("users").Between(
+		[]interface{}{platform, r.MinVal},
+		[]interface{}{platform, r.MaxVal},
+		r.BetweenOpts{Index: "region_rating"},
+	).OrderBy(r.OrderByOpts{Index: r.Desc("region_rating")})
+}
+
+// Users of platform by rating, only mains of role and members of chat when set
+func (s *RethinkStore) ratingTop(platform string, role string, chat int64) r.Term {
+	query := s.byRating(platform)
+	if role != "" {
+		query = query.Filter(r.Row.Field("role").Eq(role))
+	}
+	if chat != 0 {
+		query = query.Filter(r.Row.Field("chat").Eq(chat))
+	}
+
+	return query
+}
+
+// Leave out users not refreshed for longer than max age
+func (s *RethinkStore) fresh(query r.Term) r.Term {
+	if s.maxAge == 0 {
+		return query
+	}
+
+	return query.Filter(r.Row.Field("date").Gt(r.Now().Sub(s.maxAge.Seconds())))
 }
 
-func GetRank(id string, index r.Term) (Top, error) {
+// Place of user in population ordered in descending
+func (s *RethinkStore) ranking(id string, population r.Term) (Ranking, error) {
 	res, err := r.Do(
-		r.Table("users").OrderBy(r.Desc(index)).OffsetsOf(r.Row.Field("id").Eq(id)).Nth(0),
-		r.Table("users").Count(index.Ne(0)),
+		population.OffsetsOf(r.Row.Field("id").Eq(id)).Nth(0),
+		population.Count(),
 		func(place r.Term, count r.Term) r.Term {
 			return r.Expr(
 				map[string]interface{}{
-					"place": place.Add(1),
-					"rank":  place.Div(count).Mul(100),
+					"place":      place.Add(1),
+					"population": count,
+					"percentile": place.Add(1).Div(count).Mul(100),
 				},
 			)
 		},
-	).Run(session)
+	).Run(s.session)
+	if err != nil {
+		return Ranking{}, err
+	}
 
-	var top Top
-	err = res.One(&top)
+	var ranking Ranking
+	err = res.One(&ranking)
 	if err != nil {
 		log.Warn(err)
-		return Top{}, err
+		return Ranking{}, err
 	}
 
-	return top, nil
+	defer res.Close()
+	return ranking, nil
 }
 
-func InsertUser(user User) (r.WriteResponse, error) {
+func (s *RethinkStore) GetRatingPlace(id string, region string) (Ranking, error) {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return Ranking{}, err
+	}
+	if !IsRanked(user, s.maxAge, time.Now()) || user.Profile.Rating <= 0 {
+		return Ranking{}, ErrNotFound
+	}
+
+	platform := region
+	if platform == "" {
+		platform = PlatformOf(user.Region)
+	}
+
+	population := s.fresh(s.byRating(platform).Filter(r.Row.Field("profile").Field("Rating").Gt(0)))
+
+	return s.ranking(id, population)
+}
+
+func (s *RethinkStore) GetRank(id string, path ...string) (Ranking, error) {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return Ranking{}, err
+	}
+	if value, ok := lookupNumber(user, path); !ok || value <= 0 || !IsRanked(user, s.maxAge, time.Now()) {
+		return Ranking{}, ErrNotFound
+	}
+
+	value := r.Row
+	for _, field := range path {
+		value = value.Field(field)
+	}
+	// Percentages like weaponAccuracy come as strings, which would be
+	// compared as text, so strip "%" like lookupNumber does
+	index := r.Branch(value.TypeOf().Eq("STRING"), value.Split("%").Nth(0).CoerceTo("NUMBER"), value)
+
+	population := r.Table("users").Filter(index.Gt(0))
+	if IsConsole(user.Region) {
+		population = population.Filter(r.Row.Field("region").Eq("psn").Or(r.Row.Field("region").Eq("xbl")))
+	} else {
+		population = population.Filter(r.Row.Field("region").Ne("psn").And(r.Row.Field("region").Ne("xbl")))
+	}
+
+	return s.ranking(id, s.fresh(population).OrderBy(r.Desc(index)))
+}
+
+func (s *RethinkStore) InsertUser(user User) error {
 	newDoc := map[string]interface{}{
-		"id":      user.Id,
-		"profile": user.Profile,
-		"nick":    user.Nick,
-		"region":  user.Region,
-		"date":    r.Now(),
+		"id":       user.Id,
+		"profile":  user.Profile,
+		"nick":     user.Nick,
+		"region":   user.Region,
+		"chat":     user.Chat,
+		"settings": user.Settings,
+		"username": user.Username,
+		"patreon":  user.Patreon,
+		"role":     MainRoleOf(user.Profile),
+		"date":     r.Now(),
 	}
 
-	res, err := r.Table("users").Insert(newDoc, r.InsertOpts{
+	_, err := r.Table("users").Insert(newDoc, r.InsertOpts{
 		Conflict: "replace",
-	}).RunWrite(session)
+	}).RunWrite(s.session)
+
+	return err
+}
+
+func (s *RethinkStore) UpdateUser(user User) (bool, error) {
+	newDoc := map[string]interface{}{
+		"id":       user.Id,
+		"chat":     user.Chat,
+		"username": user.Username,
+	}
+
+	res, err := r.Table("users").Get(user.Id).Update(newDoc).RunWrite(s.session)
 	if err != nil {
-		return r.WriteResponse{}, err
+		return false, err
+	}
+	if res.Skipped != 0 {
+		return false, ErrNotFound
+	}
+
+	return res.Replaced != 0 || res.Updated != 0, nil
+}
+
+func (s *RethinkStore) UpdateProfile(user User) error {
+	newDoc := map[string]interface{}{
+		"profile": user.Profile,
+		"role":    MainRoleOf(user.Profile),
+		"date":    r.Now(),
 	}
 
-	return res, nil
+	_, err := r.Table("users").Get(user.Id).Update(newDoc).RunWrite(s.session)
+
+	return err
 }
 
-func UpdateUser(user User) (r.WriteResponse, error) {
+func (s *RethinkStore) UpdateSettings(id string, settings Settings) error {
 	newDoc := map[string]interface{}{
-		"id":   user.Id,
-		"chat": user.Chat,
+		"settings": settings,
+	}
+
+	res, err := r.Table("users").Get(id).Update(newDoc).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if res.Skipped != 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *RethinkStore) InsertSnapshot(snapshot Snapshot) error {
+	return r.Table("history").Insert(snapshot).Exec(s.session)
+}
+
+func (s *RethinkStore) GetSnapshots(user string, from time.Time, to time.Time) ([]Snapshot, error) {
+	var lower interface{} = from
+	if from.IsZero() {
+		lower = r.MinVal
+	}
+
+	res, err := r.Table("history").Between(
+		[]interface{}{user, lower},
+		[]interface{}{user, to},
+		r.BetweenOpts{Index: "user_date"},
+	).OrderBy(r.OrderByOpts{Index: "user_date"}).Run(s.session)
+	if err != nil {
+		return []Snapshot{}, err
+	}
+
+	var snapshots []Snapshot
+	err = res.All(&snapshots)
+	if err != nil {
+		return []Snapshot{}, err
+	}
+
+	defer res.Close()
+	return snapshots, nil
+}
+
+func (s *RethinkStore) GetLastSnapshotBefore(user string, date time.Time) (Snapshot, error) {
+	res, err := r.Table("history").Between(
+		[]interface{}{user, r.MinVal},
+		[]interface{}{user, date},
+		r.BetweenOpts{Index: "user_date"},
+	).OrderBy(r.OrderByOpts{Index: r.Desc("user_date")}).Limit(1).Run(s.session)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snapshot Snapshot
+	err = res.One(&snapshot)
+	if err == r.ErrEmptyResult {
+		return Snapshot{}, ErrNotFound
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	defer res.Close()
+	return snapshot, nil
+}
+
+func (s *RethinkStore) DeleteSnapshots(ids []string) error {
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = id
+	}
+
+	return r.Table("history").GetAll(keys...).Delete().Exec(s.session)
+}
+
+func (s *RethinkStore) DeleteSnapshotsBefore(date time.Time) error {
+	return r.Table("history").Between(r.MinVal, date, r.BetweenOpts{Index: "date"}).Delete().Exec(s.session)
+}
+
+func (s *RethinkStore) GetDigestChats() ([]int64, error) {
+	res, err := r.Table("users").HasFields("chat").Filter(r.Row.Field("chat").Ne(0)).Field("chat").Distinct().Run(s.session)
+	if err != nil {
+		return []int64{}, err
+	}
+
+	var chats []int64
+	err = res.All(&chats)
+	if err != nil {
+		return []int64{}, err
 	}
 
-	res, err := r.Table("users").Get(user.Id).Update(newDoc).RunWrite(session)
+	defer res.Close()
+	return chats, nil
+}
+
+func (s *RethinkStore) GetDigest(chat int64) (Digest, error) {
+	res, err := r.Table("chats").Get(chat).Run(s.session)
 	if err != nil {
-		return r.WriteResponse{}, err
+		return Digest{}, err
+	}
+
+	var digest Digest
+	err = res.One(&digest)
+	if err == r.ErrEmptyResult {
+		return Digest{}, ErrNotFound
 	}
+	if err != nil {
+		return Digest{}, err
+	}
+
+	defer res.Close()
+	return digest, nil
+}
 
-	return res, nil
+func (s *RethinkStore) SaveDigest(digest Digest) error {
+	return r.Table("chats").Insert(digest, r.InsertOpts{Conflict: "replace"}).Exec(s.session)
 }
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errWrongSchedule = errors.New("digest: wrong schedule")
+
+var weekdays = map[string]time.Weekday{
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+	"sun": time.Sunday,
+}
+
+// Chats without /digest settings get weekly digest on Monday 18:00 UTC
+func DefaultDigest(chat int64) Digest {
+	return Digest{
+		Chat:     chat,
+		Schedule: "weekly",
+		Weekday:  time.Monday,
+		Hour:     18,
+	}
+}
+
+// The most recent moment digest should have been posted at
+func (digest Digest) LastScheduled(now time.Time) time.Time {
+	now = now.UTC()
+	scheduled := time.Date(now.Year(), now.Month(), now.Day(), digest.Hour, digest.Minute, 0, 0, time.UTC)
+
+	if digest.Schedule == "weekly" {
+		scheduled = scheduled.AddDate(0, 0, int(digest.Weekday-scheduled.Weekday()))
+		if scheduled.After(now) {
+			scheduled = scheduled.AddDate(0, 0, -7)
+		}
+	} else if scheduled.After(now) {
+		scheduled = scheduled.AddDate(0, 0, -1)
+	}
+
+	return scheduled
+}
+
+func (digest Digest) String() string {
+	switch digest.Schedule {
+	case "daily":
+		return fmt.Sprintf("daily at %02d:%02d UTC", digest.Hour, digest.Minute)
+	case "weekly":
+		return fmt.Sprintf("weekly on %s at %02d:%02d UTC", digest.Weekday, digest.Hour, digest.Minute)
+	}
+
+	return "off"
+}
+
+// Check all chats every minute
+func RunDigestScheduler() {
+	for {
+		SendDueDigests(time.Now())
+		time.Sleep(time.Minute)
+	}
+}
+
+func SendDueDigests(now time.Time) {
+	chats, err := store.GetDigestChats()
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	for _, chat := range chats {
+		digest, err := store.GetDigest(chat)
+		if err == ErrNotFound {
+			digest = DefaultDigest(chat)
+		} else if err != nil {
+			log.Warn(err)
+			continue
+		}
+
+		if digest.Schedule != "daily" && digest.Schedule != "weekly" {
+			continue
+		}
+
+		// Chat seen for the first time, start counting from now
+		if digest.LastSent.IsZero() {
+			digest.LastSent = now
+			err = store.SaveDigest(digest)
+			if err != nil {
+				log.Warn(err)
+			}
+			continue
+		}
+
+		if digest.LastSent.Before(digest.LastScheduled(now)) {
+			SendDigest(digest, now)
+		}
+	}
+}
+
+func SendDigest(digest Digest, now time.Time) {
+	users, err := store.GetChatUsers(digest.Chat)
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	text := fmt.Sprintf("<b>%s Digest</b>\n\n", strings.Title(digest.Schedule))
+
+	type mover struct {
+		user        User
+		progression Progression
+	}
+
+	var movers []mover
+	heroTime := make(map[string]int)
+	for _, user := range users {
+		snapshots, err := GetSnapshotsSince(user.Id, digest.LastSent, now)
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+		if len(snapshots) < 2 {
+			continue
+		}
+
+		movers = append(movers, mover{user, NewProgression(snapshots)})
+		for hero, seconds := range HeroTimePlayed(snapshots) {
+			heroTime[hero] += seconds
+		}
+	}
+
+	if len(movers) == 0 {
+		text += "Nobody played since last digest 😴\n"
+	} else {
+		sort.Slice(movers, func(i, j int) bool {
+			return movers[i].progression.End-movers[i].progression.Start > movers[j].progression.End-movers[j].progression.Start
+		})
+		gainer, loser := movers[0], movers[len(movers)-1]
+		if diff := gainer.progression.End - gainer.progression.Start; diff > 0 {
+			text += fmt.Sprintf("📈 <b>%s</b> %+d SR\n", DisplayNick(gainer.user), diff)
+		}
+		if diff := loser.progression.End - loser.progression.Start; diff < 0 {
+			text += fmt.Sprintf("📉 <b>%s</b> %+d SR\n", DisplayNick(loser.user), diff)
+		}
+
+		sort.Slice(movers, func(i, j int) bool {
+			return movers[i].progression.Net.Games > movers[j].progression.Net.Games
+		})
+		if games := movers[0].progression.Net.Games; games > 0 {
+			text += fmt.Sprintf("🎮 <b>%s</b> %d games\n", DisplayNick(movers[0].user), games)
+		}
+
+		// Ties go to the first key, map order is random
+		var topHero string
+		for hero, seconds := range heroTime {
+			if topHero == "" || seconds > heroTime[topHero] || (seconds == heroTime[topHero] && hero < topHero) {
+				topHero = hero
+			}
+		}
+		if topHero != "" {
+			text += fmt.Sprintf("🦸 <b>%s</b> %d min played\n", catalog.Name(topHero), heroTime[topHero]/60)
+		}
+	}
+
+	standings := make(map[string]int)
+	for _, platform := range []string{"pc", "console"} {
+		top, err := store.GetRatingTop(platform, "", 0, 10, digest.Chat)
+		if err != nil {
+			log.Warn(err)
+			return
+		}
+		if len(top) == 0 {
+			continue
+		}
+
+		text += fmt.Sprintf("\n<b>Rating Top (%s):</b>\n", platform)
+		for i, elem := range top {
+			place := i + 1
+			standings[elem.Id] = place
+
+			var movement string
+			if lastPlace, ok := digest.Standings[elem.Id]; !ok {
+				movement = "🆕"
+			} else if lastPlace > place {
+				movement = fmt.Sprint("⬆️", lastPlace-place)
+			} else if lastPlace < place {
+				movement = fmt.Sprint("⬇️", place-lastPlace)
+			}
+
+			text += fmt.Sprintf("%d. %s (%d) %s\n", place, elem.Patreon+DisplayNick(elem), elem.Profile.Rating, movement)
+		}
+	}
+
+	msg := tgbotapi.NewMessage(digest.Chat, text)
+	msg.ParseMode = "HTML"
+	_, err = bot.Send(msg)
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	log.Infof("digest sent to %d", digest.Chat)
+
+	digest.LastSent = now
+	digest.Standings = standings
+	err = store.SaveDigest(digest)
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+func DigestCommand(update tgbotapi.Update, args []string) {
+	chat := update.Message.Chat.ID
+
+	digest, err := store.GetDigest(chat)
+	if err == ErrNotFound {
+		digest = DefaultDigest(chat)
+	} else if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	var text string
+	if len(args) == 0 {
+		text = fmt.Sprintf("<b>Digest:</b> %s", digest)
+	} else {
+		err = ParseDigestSchedule(&digest, args)
+		if err != nil {
+			text = "<b>Example:</b> <code>/digest off|daily 20:00|weekly mon 20:00</code>"
+		} else {
+			if digest.LastSent.IsZero() {
+				digest.LastSent = time.Now()
+			}
+
+			err = store.SaveDigest(digest)
+			if err != nil {
+				log.Warn(err)
+				return
+			}
+
+			log.Info("/digest command executed successful")
+			text = fmt.Sprintf("<b>Done:</b> Digest is %s", digest)
+		}
+	}
+
+	msg := tgbotapi.NewMessage(chat, text)
+	msg.ParseMode = "HTML"
+	bot.Send(msg)
+}
+
+// Apply "off", "daily 20:00" or "weekly mon 20:00"
+func ParseDigestSchedule(digest *Digest, args []string) error {
+	schedule := strings.ToLower(args[0])
+	args = args[1:]
+
+	switch schedule {
+	case "off":
+		digest.Schedule = schedule
+		return nil
+	case "daily":
+	case "weekly":
+		if len(args) == 0 {
+			return errWrongSchedule
+		}
+
+		weekday, ok := weekdays[strings.ToLower(args[0])]
+		if !ok {
+			return errWrongSchedule
+		}
+		digest.Weekday = weekday
+		args = args[1:]
+	default:
+		return errWrongSchedule
+	}
+
+	if len(args) != 1 {
+		return errWrongSchedule
+	}
+
+	clock := strings.Split(args[0], ":")
+	hour, err := strconv.Atoi(clock[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return errWrongSchedule
+	}
+
+	var minute int
+	if len(clock) == 2 {
+		minute, err = strconv.Atoi(clock[1])
+		if err != nil || minute < 0 || minute > 59 {
+			return errWrongSchedule
+		}
+	}
+
+	digest.Schedule = schedule
+	digest.Hour = hour
+	digest.Minute = minute
+
+	return nil
+}
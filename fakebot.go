@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In-process Bot: updates are pushed by the caller and everything sent
+// is recorded. Used by tests and by CONSOLE mode.
+type FakeBot struct {
+	mu        sync.Mutex
+	updates   chan tgbotapi.Update
+	sent      []tgbotapi.Chattable
+	messageId int
+	answers   []tgbotapi.InlineConfig
+	// Called for every outgoing Chattable, optional
+	OnSend func(c tgbotapi.Chattable)
+	// Called for every inline query answer, optional
+	OnAnswer func(config tgbotapi.InlineConfig)
+}
+
+func NewFakeBot() *FakeBot {
+	return &FakeBot{
+		updates: make(chan tgbotapi.Update, 100),
+	}
+}
+
+func (b *FakeBot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	b.mu.Lock()
+	b.sent = append(b.sent, c)
+	b.messageId++
+	message := tgbotapi.Message{
+		MessageID: b.messageId,
+		Chat:      &tgbotapi.Chat{ID: ChattableChatID(c)},
+		Date:      int(time.Now().Unix()),
+	}
+	onSend := b.OnSend
+	b.mu.Unlock()
+
+	if onSend != nil {
+		onSend(c)
+	}
+
+	return message, nil
+}
+
+func (b *FakeBot) AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	return tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (b *FakeBot) AnswerInlineQuery(config tgbotapi.InlineConfig) (tgbotapi.APIResponse, error) {
+	b.mu.Lock()
+	b.answers = append(b.answers, config)
+	onAnswer := b.OnAnswer
+	b.mu.Unlock()
+
+	if onAnswer != nil {
+		onAnswer(config)
+	}
+
+	return tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (b *FakeBot) Updates() (<-chan tgbotapi.Update, error) {
+	return b.updates, nil
+}
+
+func (b *FakeBot) UserName() string {
+	return "OverStatsBot"
+}
+
+func (b *FakeBot) Push(update tgbotapi.Update) {
+	b.updates <- update
+}
+
+func (b *FakeBot) Close() {
+	close(b.updates)
+}
+
+// Everything sent so far, Reset clears it
+func (b *FakeBot) Sent() []tgbotapi.Chattable {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]tgbotapi.Chattable{}, b.sent...)
+}
+
+// Inline query answers so far, Reset clears them
+func (b *FakeBot) Answers() []tgbotapi.InlineConfig {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]tgbotapi.InlineConfig{}, b.answers...)
+}
+
+func (b *FakeBot) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sent = nil
+	b.answers = nil
+}
+
+// Synthetic text message, chat is private when chatId equals userId
+func NewFakeUpdate(chatId int64, userId int, text string) tgbotapi.Update {
+	chatType := "private"
+	if chatId != int64(userId) {
+		chatType = "supergroup"
+	}
+
+	return tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			From: &tgbotapi.User{ID: userId, UserName: fmt.Sprint("user", userId)},
+			Chat: &tgbotapi.Chat{ID: chatId, Type: chatType},
+			Date: int(time.Now().Unix()),
+			Text: text,
+		},
+	}
+}
+
+// Synthetic inline button press on message sent by bot
+func NewFakeCallback(message tgbotapi.Message, userId int, data string) tgbotapi.Update {
+	return tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      fmt.Sprint("callback", time.Now().UnixNano()),
+			From:    &tgbotapi.User{ID: userId, UserName: fmt.Sprint("user", userId)},
+			Message: &message,
+			Data:    data,
+		},
+	}
+}
+
+// Synthetic inline query, like typing "@OverStatsBot me" in any chat
+func NewFakeInlineQuery(userId int, query string) tgbotapi.Update {
+	return tgbotapi.Update{
+		InlineQuery: &tgbotapi.InlineQuery{
+			ID:    fmt.Sprint("inline", time.Now().UnixNano()),
+			From:  &tgbotapi.User{ID: userId, UserName: fmt.Sprint("user", userId)},
+			Query: query,
+		},
+	}
+}
+
+func ChattableChatID(c tgbotapi.Chattable) int64 {
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		return c.ChatID
+	case tgbotapi.PhotoConfig:
+		return c.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return c.ChatID
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return c.ChatID
+	}
+
+	return 0
+}
+
+// Human readable form of outgoing Chattable
+func ChattableText(c tgbotapi.Chattable) string {
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		return c.Text
+	case tgbotapi.PhotoConfig:
+		return "[photo] " + c.Caption
+	case tgbotapi.EditMessageTextConfig:
+		return fmt.Sprintf("[edit %d] %s", c.MessageID, c.Text)
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return fmt.Sprintf("[edit %d keyboard]", c.MessageID)
+	}
+
+	return fmt.Sprintf("%T", c)
+}
+
+// Reads private messages from input line by line and writes replies to
+// output. Lines like "@OverStatsBot me" are inline queries.
+func NewConsoleBot(input io.Reader, output io.Writer) *FakeBot {
+	const userId = 1
+
+	b := NewFakeBot()
+	b.OnSend = func(c tgbotapi.Chattable) {
+		fmt.Fprintf(output, "--- to %d\n%s\n", ChattableChatID(c), ChattableText(c))
+	}
+	b.OnAnswer = func(config tgbotapi.InlineConfig) {
+		fmt.Fprintf(output, "--- inline %d results\n", len(config.Results))
+		for _, result := range config.Results {
+			if article, ok := result.(tgbotapi.InlineQueryResultArticle); ok {
+				fmt.Fprintf(output, "[%s] %s\n", article.Title, article.Description)
+			}
+		}
+		if config.SwitchPMText != "" {
+			fmt.Fprintf(output, "[pm] %s\n", config.SwitchPMText)
+		}
+	}
+
+	go func() {
+		prefix := "@" + b.UserName() + " "
+		scanner := bufio.NewScanner(input)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, prefix) {
+				b.Push(NewFakeInlineQuery(userId, strings.TrimPrefix(line, prefix)))
+			} else {
+				b.Push(NewFakeUpdate(userId, userId, line))
+			}
+		}
+		b.Close()
+	}()
+
+	return b
+}
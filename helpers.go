@@ -4,13 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/sdwolfe32/ovrstat/ovrstat"
-	r "gopkg.in/gorethink/gorethink.v3"
-	"sort"
+	"html"
+	"strconv"
 	"strings"
 )
 
 // Make small text summary based on profile
-func MakeSummary(user User, top Top, mode string) string {
+func MakeSummary(user User, top Ranking, regionTop Ranking, mode string) string {
 	text := fmt.Sprintf("<b>%s</b> (<b>%d</b> sr / <b>%d</b> lvl)\n", user.Patreon+user.Profile.Name, user.Profile.Rating, user.Profile.Prestige*100+user.Profile.Level)
 
 	var stats ovrstat.StatsCollection
@@ -21,20 +21,8 @@ func MakeSummary(user User, top Top, mode string) string {
 		stats = user.Profile.QuickPlayStats
 	}
 
-	if careerStats, ok := stats.CareerStats["allHeroes"]; ok {
-		var basicStats Report
-		if gamesPlayed, ok := careerStats.Game["gamesPlayed"]; ok {
-			basicStats.Games = int(gamesPlayed.(float64))
-		}
-		if gamesWon, ok := careerStats.Game["gamesWon"]; ok {
-			basicStats.Wins = int(gamesWon.(float64))
-		}
-		if gamesTied, ok := careerStats.Game["gamesTied"]; ok {
-			basicStats.Ties = int(gamesTied.(float64))
-		}
-		if gamesLost, ok := careerStats.Game["gamesLost"]; ok {
-			basicStats.Losses = int(gamesLost.(float64))
-		}
+	if _, ok := stats.CareerStats["allHeroes"]; ok {
+		basicStats := BasicStats(stats)
 
 		if mode == "CompetitiveStats" {
 			text += fmt.Sprintf("%d-%d-%d / <b>%0.2f%%</b> winrate\n", basicStats.Wins, basicStats.Losses, basicStats.Ties, float64(basicStats.Wins)/float64(basicStats.Games)*100)
@@ -42,58 +30,39 @@ func MakeSummary(user User, top Top, mode string) string {
 			text += fmt.Sprintf("<b>%d</b> wins\n", basicStats.Wins)
 		}
 
-		// Temp struct for k/d counting
-		type KD struct {
-			Eliminations float64
-			Deaths       float64
-			Ratio        float64
+		if split := NewRoleSplit(stats); len(split) > 0 {
+			text += split.String() + "\n"
 		}
 
-		var kd KD
-
-		if eliminations, ok := careerStats.Combat["eliminations"]; ok {
-			kd.Eliminations = eliminations.(float64)
-		}
-		if deaths, ok := careerStats.Combat["deaths"]; ok {
-			kd.Deaths = deaths.(float64)
-		}
-
-		if kd.Deaths > 0 {
-			kd.Ratio = kd.Eliminations / kd.Deaths
-			text += fmt.Sprintf("<b>%0.2f</b> k/d\n\n", kd.Ratio)
+		if kd, ok := KDRatio(stats); ok {
+			text += fmt.Sprintf("<b>%0.2f</b> k/d\n\n", kd)
 		}
 
 		if mode == "CompetitiveStats" {
-			text += fmt.Sprintf("<b>Rating Top:</b>\n#%d (%0.2f%%)\n\n", top.Place, top.Rank)
+			text += "<b>Rating Top:</b>\n"
+			if top.Place == 0 {
+				text += "not ranked yet\n\n"
+			} else {
+				text += fmt.Sprintf("%s %s\n", top, PlatformOf(user.Region))
+				text += fmt.Sprintf("%s %s\n\n", regionTop, strings.ToUpper(user.Region))
+			}
 		}
 
-		text += "<b>7 top played heroes:</b>\n"
-		var topPlayedHeroes Heroes
-		for name, hero := range stats.TopHeroes {
-			topPlayedHeroes = append(topPlayedHeroes, Hero{
-				Name:                name,
-				TimePlayedInSeconds: hero.TimePlayedInSeconds,
-			})
+		heroes := SortedHeroes(stats, "time")
+		if len(heroes) > 7 {
+			heroes = heroes[:7]
 		}
 
-		// Sort top played heroes in descending
-		sort.Sort(sort.Reverse(topPlayedHeroes))
-
-		for i := 0; i < 7; i++ {
-			var format string
-			if mode == "CompetitiveStats" {
-				format = fmt.Sprint("%s (%s) /h_%s\n")
-			} else if mode == "QuickPlayStats" {
-				format = fmt.Sprint("%s (%s) /h_%s_quick\n")
-			}
+		suffix := ""
+		if mode == "QuickPlayStats" {
+			suffix = "_quick"
+		}
 
-			text += fmt.Sprintf(
-				format,
-				strings.Title(strings.ToLower(topPlayedHeroes[i].Name)),
-				stats.TopHeroes[topPlayedHeroes[i].Name].TimePlayed,
-				topPlayedHeroes[i].Name,
-			)
+		text += fmt.Sprintf("<b>%d top played heroes:</b>\n", len(heroes))
+		for _, name := range heroes {
+			text += fmt.Sprintf("%s (%s) /h_%s%s\n", catalog.Name(name), stats.TopHeroes[name].TimePlayed, name, suffix)
 		}
+		text += fmt.Sprintf("All heroes: /heroes%s\n", suffix)
 	}
 
 	text += fmt.Sprint("\n<b>Last Updated:</b>\n", user.Date.Format("15:04:05 / 02.01.2006 MST"))
@@ -102,7 +71,8 @@ func MakeSummary(user User, top Top, mode string) string {
 }
 
 func MakeHeroSummary(hero string, mode string, user User) string {
-	text := fmt.Sprintf("<b>%s</b>", strings.Title(strings.ToLower(hero)))
+	// Hero missing in catalog is named after raw user input
+	text := fmt.Sprintf("<b>%s</b>", html.EscapeString(catalog.Name(hero)))
 
 	var stats ovrstat.StatsCollection
 	if mode == "CompetitiveStats" {
@@ -113,7 +83,7 @@ func MakeHeroSummary(hero string, mode string, user User) string {
 	}
 
 	if heroStats, ok := stats.CareerStats[hero]; ok {
-		if heroAdditionalStats, ok := stats.TopHeroes[hero]; ok {
+		if heroAdditionalStats, ok := stats.TopHeroes[hero]; ok && heroAdditionalStats != nil {
 			text += fmt.Sprintf(" (%s)\n", heroAdditionalStats.TimePlayed)
 			if cards, ok := heroStats.MatchAwards["cards"]; ok {
 				text += fmt.Sprintf("🃏%0.0f ", cards)
@@ -133,386 +103,36 @@ func MakeHeroSummary(hero string, mode string, user User) string {
 			if mode == "CompetitiveStats" {
 				text += fmt.Sprintf("<b>%d%%</b> hero winrate", heroAdditionalStats.WinPercentage)
 
-				res, err := GetRank(
-					user.Id,
-					r.Row.Field("profile").Field(mode).Field("TopHeroes").Field(hero).Field("WinPercentage"),
-				)
-				if err != nil {
-					text += fmt.Sprint(" (error)\n")
-				} else {
-					text += fmt.Sprintf(" (#%d, %0.0f%%)\n", res.Place, res.Rank)
-				}
+				res, err := store.GetRank(user.Id, "profile", mode, "TopHeroes", hero, "WinPercentage")
+				text += MakeRankingSuffix(res, err)
 			}
 
-			if eliminationsPerLife, ok := heroStats.Combat["eliminationsPerLife"]; ok {
-				text += fmt.Sprintf("<b>%0.2f</b> k/d ratio", eliminationsPerLife)
-
-				res, err := GetRank(
-					user.Id,
-					r.Row.Field("profile").Field(mode).Field("CareerStats").Field(hero).Field("Combat").Field("eliminationsPerLife"),
-				)
-				if err != nil {
-					text += fmt.Sprint(" (error)\n")
-				} else {
-					text += fmt.Sprintf(" (#%d, %0.0f%%)\n", res.Place, res.Rank)
+			for _, spec := range catalog.Common {
+				if line, ok := spec.Render(stats, hero); ok {
+					text += line
+					if spec.Rank {
+						path := []string{"profile", mode, "CareerStats", hero, spec.Group, spec.Key}
+						res, err := store.GetRank(user.Id, path...)
+						text += MakeRankingSuffix(res, err)
+					} else {
+						text += "\n"
+					}
 				}
 			}
 
-			if accuracy, ok := heroStats.Combat["weaponAccuracy"]; ok {
-				text += fmt.Sprintf("<b>%s</b> accuracy", accuracy)
-
-				res, err := GetRank(
-					user.Id,
-					r.Row.Field("profile").Field(mode).Field("CareerStats").Field(hero).Field("Combat").Field("weaponAccuracy"),
-				)
-				if err != nil {
-					text += fmt.Sprint(" (error)\n")
-				} else {
-					text += fmt.Sprintf(" (#%d, %0.0f%%)\n", res.Place, res.Rank)
+			// HERO SPECIFIC
+			if heroSpec, ok := catalog.Hero(hero); ok {
+				text += "\n<b>Hero Specific:</b>\n"
+				for _, spec := range heroSpec.Stats {
+					if line, ok := spec.Render(stats, hero); ok {
+						text += line + "\n"
+					}
 				}
 			}
 
-			timePlayedInMinutes := float64(heroAdditionalStats.TimePlayedInSeconds) / 60
-
-			if eliminations, ok := heroStats.Combat["eliminations"]; ok {
-				eliminationsPerMin := eliminations.(float64) / timePlayedInMinutes
-				text += fmt.Sprintf("<b>%0.2f</b> eliminations per min\n", eliminationsPerMin)
-			}
-
-			if damageDone, ok := heroStats.Combat["damageDone"]; ok {
-				damagePerMin := damageDone.(float64) / timePlayedInMinutes
-				text += fmt.Sprintf("<b>%0.0f</b> damage per min\n", damagePerMin)
-			}
-
-			if blocked, ok := heroStats.Miscellaneous["damageBlocked"]; ok {
-				blockedPerMin := blocked.(float64) / timePlayedInMinutes
-				text += fmt.Sprintf("<b>%0.0f</b> blocked per min\n", blockedPerMin)
-			}
-
-			if healing, ok := heroStats.Assists["healingDone"]; ok {
-				healingPerMin := healing.(float64) / timePlayedInMinutes
-				text += fmt.Sprintf("<b>%0.0f</b> healing per min\n", healingPerMin)
-			}
-
-			if objKills, ok := heroStats.Combat["objectiveKills"]; ok {
-				objKillsPerMin := objKills.(float64) / timePlayedInMinutes
-				text += fmt.Sprintf("<b>%0.2f</b> obj. kills per min\n", objKillsPerMin)
-			}
-
-			if crits, ok := heroStats.Combat["criticalHits"]; ok {
-				critsPerMin := crits.(float64) / timePlayedInMinutes
-				text += fmt.Sprintf("<b>%0.2f</b> crits per min\n", critsPerMin)
-			}
-
-			// HERO SPECIFIC
-			text += "\n<b>Hero Specific:</b>\n"
-			switch hero {
-			case "ana":
-				if scopedAccuracy, ok := heroStats.HeroSpecific["scopedAccuracy"]; ok {
-					text += fmt.Sprintf("<b>%s</b> scoped accuracy\n", scopedAccuracy)
-				}
-				if enemiesSlept, ok := heroStats.HeroSpecific["enemiesSlept"]; ok {
-					enemiesSleptPerMin := enemiesSlept.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> enemies slept per min\n", enemiesSleptPerMin)
-				}
-			case "bastion":
-				if reconKills, ok := heroStats.HeroSpecific["reconKills"]; ok {
-					reconKillsPerMin := reconKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> recon kills per min\n", reconKillsPerMin)
-				}
-				if sentryKills, ok := heroStats.HeroSpecific["sentryKills"]; ok {
-					sentryKillsPerMin := sentryKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> sentry kills per min\n", sentryKillsPerMin)
-				}
-				if tankKills, ok := heroStats.HeroSpecific["tankKills"]; ok {
-					tankKillsPerMin := tankKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> tank kills per min\n", tankKillsPerMin)
-				}
-			case "dVa":
-				if blocked, ok := heroStats.HeroSpecific["damageBlocked"]; ok {
-					blockedPerMin := blocked.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> blocked per min\n", blockedPerMin)
-				}
-				if mechsCalled, ok := heroStats.HeroSpecific["mechsCalled"]; ok {
-					mechsCalledPerMin := mechsCalled.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> mechs called per min\n", mechsCalledPerMin)
-				}
-				if mechDeaths, ok := heroStats.HeroSpecific["mechDeaths"]; ok {
-					mechDeathsPerMin := mechDeaths.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> mech deaths per min\n", mechDeathsPerMin)
-				}
-				if selfDestructKills, ok := heroStats.HeroSpecific["selfDestructKills"]; ok {
-					selfDestructKillsPerMin := selfDestructKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> self destruct kills per min\n", selfDestructKillsPerMin)
-				}
-			case "doomfist":
-				if abilityDamageDone, ok := heroStats.HeroSpecific["abilityDamageDone"]; ok {
-					abilityDamageDonePerMin := abilityDamageDone.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> ability damage done per min\n", abilityDamageDonePerMin)
-				}
-				if meteorStrikeKills, ok := heroStats.HeroSpecific["meteorStrikeKills"]; ok {
-					meteorStrikeKillsPerMin := meteorStrikeKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> meteor strike kills per min\n", meteorStrikeKillsPerMin)
-				}
-				if shieldsCreated, ok := heroStats.HeroSpecific["shieldsCreated"]; ok {
-					shieldsCreatedPerMin := shieldsCreated.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> shields created per min\n", shieldsCreatedPerMin)
-				}
-			case "genji":
-				if damageReflected, ok := heroStats.HeroSpecific["damageReflected"]; ok {
-					damageReflectedPerMin := damageReflected.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> damage reflected per min\n", damageReflectedPerMin)
-				}
-				if dragonbladesKills, ok := heroStats.HeroSpecific["dragonbladesKills"]; ok {
-					dragonbladesKillsPerMin := dragonbladesKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> dragonblades kills per min\n", dragonbladesKillsPerMin)
-				}
-			case "hanzo":
-				if dragonstrikeKills, ok := heroStats.HeroSpecific["dragonstrikeKills"]; ok {
-					dragonstrikeKillsPerMin := dragonstrikeKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> dragonstrike kills per min\n", dragonstrikeKillsPerMin)
-				}
-				if scatterArrowKills, ok := heroStats.HeroSpecific["scatterArrowKills"]; ok {
-					scatterArrowKillsPerMin := scatterArrowKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> scatter arrow kills per min\n", scatterArrowKillsPerMin)
-				}
-			case "junkrat":
-				if enemiesTrapped, ok := heroStats.HeroSpecific["enemiesTrapped"]; ok {
-					enemiesTrappedPerMin := enemiesTrapped.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> enemies trapped per min\n", enemiesTrappedPerMin)
-				}
-				if ripTireKills, ok := heroStats.HeroSpecific["ripTireKills"]; ok {
-					ripTireKillsPerMin := ripTireKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> rip tire kills per min\n", ripTireKillsPerMin)
-				}
-			case "lucio":
-				if soundBarriersProvided, ok := heroStats.HeroSpecific["soundBarriersProvided"]; ok {
-					soundBarriersProvidedPerMin := soundBarriersProvided.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> sound barriers provided per min\n", soundBarriersProvidedPerMin)
-				}
-			case "mccree":
-				if deadeyeKills, ok := heroStats.HeroSpecific["deadeyeKills"]; ok {
-					deadeyeKillsPerMin := deadeyeKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> deadeye kills per min\n", deadeyeKillsPerMin)
-				}
-				if fanTheHammerKills, ok := heroStats.HeroSpecific["fanTheHammerKills"]; ok {
-					fanTheHammerKillsPerMin := fanTheHammerKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> fan the hammer kills per min\n", fanTheHammerKillsPerMin)
-				}
-			case "mei":
-				if damageBlocked, ok := heroStats.HeroSpecific["damageBlocked"]; ok {
-					damageBlockedPerMin := damageBlocked.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> damage blocked per min\n", damageBlockedPerMin)
-				}
-				if blizzardKills, ok := heroStats.HeroSpecific["blizzardKills"]; ok {
-					blizzardKillsPerMin := blizzardKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> blizzard kills per min\n", blizzardKillsPerMin)
-				}
-				if enemiesFrozen, ok := heroStats.HeroSpecific["enemiesFrozen"]; ok {
-					enemiesFrozenPerMin := enemiesFrozen.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> enemies frozen per min\n", enemiesFrozenPerMin)
-				}
-			case "mercy":
-				if damageAmplified, ok := heroStats.HeroSpecific["damageAmplified"]; ok {
-					damageAmplifiedPerMin := damageAmplified.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> damage amplified per min\n", damageAmplifiedPerMin)
-				}
-				if blasterKills, ok := heroStats.HeroSpecific["blasterKills"]; ok {
-					blasterKillsPerMin := blasterKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> blaster kills per min\n", blasterKillsPerMin)
-				}
-				if playersResurrected, ok := heroStats.HeroSpecific["playersResurrected"]; ok {
-					playersResurrectedPerMin := playersResurrected.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> players resurrected per min\n", playersResurrectedPerMin)
-				}
-			case "moira":
-				if selfHealing, ok := heroStats.HeroSpecific["selfHealing"]; ok {
-					selfHealingPerMin := selfHealing.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> self healing per min\n", selfHealingPerMin)
-				}
-				if coalescenceKills, ok := heroStats.HeroSpecific["coalescenceKills"]; ok {
-					coalescenceKillsPerMin := coalescenceKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> coalescence kills per min\n", coalescenceKillsPerMin)
-				}
-				if coalescenceHealing, ok := heroStats.HeroSpecific["coalescenceHealing"]; ok {
-					coalescenceHealingPerMin := coalescenceHealing.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> coalescence healing done per min\n", coalescenceHealingPerMin)
-				}
-			case "orisa":
-				if damageAmplified, ok := heroStats.HeroSpecific["damageAmplified"]; ok {
-					damageAmplifiedPerMin := damageAmplified.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> damage amplified per min\n", damageAmplifiedPerMin)
-				}
-				if damageBlocked, ok := heroStats.HeroSpecific["damageBlocked"]; ok {
-					damageBlockedPerMin := damageBlocked.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> damage blocked per min\n", damageBlockedPerMin)
-				}
-			case "pharah":
-				if barrageKills, ok := heroStats.HeroSpecific["barrageKills"]; ok {
-					barrageKillsPerMin := barrageKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> barrage kills per min\n", barrageKillsPerMin)
-				}
-				if rocketDirectHits, ok := heroStats.HeroSpecific["rocketDirectHits"]; ok {
-					rocketDirectHits := rocketDirectHits.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> rocket direct hits per min\n", rocketDirectHits)
-				}
-			case "reaper":
-				if deathsBlossomKills, ok := heroStats.HeroSpecific["deathsBlossomKills"]; ok {
-					deathsBlossomKillsPerMin := deathsBlossomKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> blossom kills per min\n", deathsBlossomKillsPerMin)
-				}
-				if selfHealing, ok := heroStats.HeroSpecific["selfHealing"]; ok {
-					selfHealingPerMin := selfHealing.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> self healing per min\n", selfHealingPerMin)
-				}
-			case "reinhardt":
-				if damageBlocked, ok := heroStats.HeroSpecific["damageBlocked"]; ok {
-					damageBlockedPerMin := damageBlocked.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> damage blocked per min\n", damageBlockedPerMin)
-				}
-				if chargeKills, ok := heroStats.HeroSpecific["chargeKills"]; ok {
-					chargeKillsPerMin := chargeKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> charge kills per min\n", chargeKillsPerMin)
-				}
-				if fireStrikeKills, ok := heroStats.HeroSpecific["fireStrikeKills"]; ok {
-					fireStrikeKillsPerMin := fireStrikeKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> fire strike kills per min\n", fireStrikeKillsPerMin)
-				}
-				if earthshatterKills, ok := heroStats.HeroSpecific["earthshatterKills"]; ok {
-					earthshatterKillsPerMin := earthshatterKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> earthshatter kills per min\n", earthshatterKillsPerMin)
-				}
-			case "roadhog":
-				if enemiesHooked, ok := heroStats.HeroSpecific["enemiesHooked"]; ok {
-					enemiesHookedPerMin := enemiesHooked.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> enemies hooked per min\n", enemiesHookedPerMin)
-				}
-				if wholeHogKills, ok := heroStats.HeroSpecific["wholeHogKills"]; ok {
-					wholeHogKillsPerMin := wholeHogKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> whole hog kills per min\n", wholeHogKillsPerMin)
-				}
-				if hookAccuracy, ok := heroStats.HeroSpecific["hookAccuracy"]; ok {
-					text += fmt.Sprintf("<b>%s</b> hook accuracy\n", hookAccuracy)
-				}
-			case "soldier76":
-				if helixRocketsKills, ok := heroStats.HeroSpecific["helixRocketsKills"]; ok {
-					helixRocketsKillsPerMin := helixRocketsKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> helix rockets kills per min\n", helixRocketsKillsPerMin)
-				}
-				if tacticalVisorKills, ok := heroStats.HeroSpecific["tacticalVisorKills"]; ok {
-					tacticalVisorKillsPerMin := tacticalVisorKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> tactical visor kills per min\n", tacticalVisorKillsPerMin)
-				}
-				if bioticFieldHealingDone, ok := heroStats.HeroSpecific["bioticFieldHealingDone"]; ok {
-					bioticFieldHealingDonePerMin := bioticFieldHealingDone.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> healing done per min\n", bioticFieldHealingDonePerMin)
-				}
-			case "sombra":
-				if enemiesHacked, ok := heroStats.HeroSpecific["enemiesHacked"]; ok {
-					enemiesHackedPerMin := enemiesHacked.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> enemies hacked per min\n", enemiesHackedPerMin)
-				}
-				if enemiesEmpd, ok := heroStats.HeroSpecific["enemiesEmpd"]; ok {
-					enemiesEmpdPerMin := enemiesEmpd.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> enemies emp'd per min\n", enemiesEmpdPerMin)
-				}
-			case "symmetra":
-				if playersTeleported, ok := heroStats.HeroSpecific["playersTeleported"]; ok {
-					playersTeleportedPerMin := playersTeleported.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> players teleported per min\n", playersTeleportedPerMin)
-				}
-				if sentryTurretsKills, ok := heroStats.HeroSpecific["sentryTurretsKills"]; ok {
-					sentryTurretsKillsPerMin := sentryTurretsKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> sentry turrets kills per min\n", sentryTurretsKillsPerMin)
-				}
-			case "torbjorn":
-				if torbjornKills, ok := heroStats.HeroSpecific["torbjornKills"]; ok {
-					torbjornKillsPerMin := torbjornKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> torbjorn kills per min\n", torbjornKillsPerMin)
-				}
-				if moltenCoreKills, ok := heroStats.HeroSpecific["moltenCoreKills"]; ok {
-					moltenCoreKillsPerMin := moltenCoreKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> molten core kills per min\n", moltenCoreKillsPerMin)
-				}
-				if turretsKills, ok := heroStats.HeroSpecific["turretsKills"]; ok {
-					turretsKillsPerMin := turretsKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> turrets kills per min\n", turretsKillsPerMin)
-				}
-				if armorPacksCreated, ok := heroStats.HeroSpecific["armorPacksCreated"]; ok {
-					armorPacksCreatedPerMin := armorPacksCreated.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> armor packs created per min\n", armorPacksCreatedPerMin)
-				}
-			case "tracer":
-				if pulseBombsKills, ok := heroStats.HeroSpecific["pulseBombsKills"]; ok {
-					pulseBombsKillsPerMin := pulseBombsKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> pulse bombs kills per min\n", pulseBombsKillsPerMin)
-				}
-				if pulseBombsAttached, ok := heroStats.HeroSpecific["pulseBombsAttached"]; ok {
-					pulseBombsAttachedPerMin := pulseBombsAttached.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> pulse bombs attached per min\n", pulseBombsAttachedPerMin)
-				}
-			case "widowmaker":
-				if scopedCriticalHits, ok := heroStats.HeroSpecific["scopedCriticalHits"]; ok {
-					scopedCriticalHitsPerMin := scopedCriticalHits.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> scoped critical hits per min\n", scopedCriticalHitsPerMin)
-				}
-				if scopedAccuracy, ok := heroStats.HeroSpecific["scopedAccuracy"]; ok {
-					text += fmt.Sprintf("<b>%s</b> scoped accuracy\n", scopedAccuracy)
-				}
-			case "winston":
-				if damageBlocked, ok := heroStats.HeroSpecific["damageBlocked"]; ok {
-					damageBlockedPerMin := damageBlocked.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> damage blocked per min\n", damageBlockedPerMin)
-				}
-				if jumpPackKills, ok := heroStats.HeroSpecific["jumpPackKills"]; ok {
-					jumpPackKillsPerMin := jumpPackKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> jump pack kills per min\n", jumpPackKillsPerMin)
-				}
-				if primalRageKills, ok := heroStats.HeroSpecific["primalRageKills"]; ok {
-					primalRageKillsPerMin := primalRageKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> primal rage kills per min\n", primalRageKillsPerMin)
-				}
-				if playersKnockedBack, ok := heroStats.HeroSpecific["playersKnockedBack"]; ok {
-					playersKnockedBackPerMin := playersKnockedBack.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> players knocked back per min\n", playersKnockedBackPerMin)
-				}
-			case "zarya":
-				if damageBlocked, ok := heroStats.HeroSpecific["damageBlocked"]; ok {
-					damageBlockedPerMin := damageBlocked.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> damage blocked per min\n", damageBlockedPerMin)
-				}
-				if highEnergyKills, ok := heroStats.HeroSpecific["highEnergyKills"]; ok {
-					highEnergyKillsPerMin := highEnergyKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> high energy kills per min\n", highEnergyKillsPerMin)
-				}
-				if gravitonSurgeKills, ok := heroStats.HeroSpecific["gravitonSurgeKills"]; ok {
-					gravitonSurgeKillsPerMin := gravitonSurgeKills.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> graviton surge kills per min\n", gravitonSurgeKillsPerMin)
-				}
-				if projectedBarriersApplied, ok := heroStats.HeroSpecific["projectedBarriersApplied"]; ok {
-					projectedBarriersAppliedPerMin := projectedBarriersApplied.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> projected barriers applied per min\n", projectedBarriersAppliedPerMin)
-				}
-				if averageEnergy, ok := heroStats.HeroSpecific["averageEnergy"]; ok {
-					text += fmt.Sprintf("<b>%0.0f%%</b> average energy\n", averageEnergy.(float64)*100)
-				}
-			case "zenyatta":
-				if transcendenceHealing, ok := heroStats.HeroSpecific["transcendenceHealing"]; ok {
-					transcendenceHealingPerMin := transcendenceHealing.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> transcendence healing per min\n", transcendenceHealingPerMin)
-				}
-				if selfHealing, ok := heroStats.HeroSpecific["selfHealing"]; ok {
-					selfHealingPerMin := selfHealing.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.0f</b> self healing per min\n", selfHealingPerMin)
-				}
-				if offensiveAssists, ok := heroStats.Assists["offensiveAssists"]; ok {
-					offensiveAssistsPerMin := offensiveAssists.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> offensive assists per min\n", offensiveAssistsPerMin)
-				}
-				if defensiveAssists, ok := heroStats.Assists["defensiveAssists"]; ok {
-					defensiveAssistsPerMin := defensiveAssists.(float64) / timePlayedInMinutes
-					text += fmt.Sprintf("<b>%0.2f</b> defensive assists per min\n", defensiveAssistsPerMin)
-				}
+			// New heroes and stats until they are added to catalog
+			if lines := catalog.RenderOther(stats, hero); len(lines) > 0 {
+				text += "\n<b>Other:</b>\n" + strings.Join(lines, "\n") + "\n"
 			}
 		} else {
 			text += "\nNOT AVAILABLE"
@@ -526,13 +146,189 @@ func MakeHeroSummary(hero string, mode string, user User) string {
 	return text
 }
 
+// Clickable /h_ commands for ambiguous hero name
+func MakeHeroSuggestions(heroes []string, quick bool) string {
+	text := "Did you mean:\n"
+	for _, hero := range heroes {
+		command := "/h_" + hero
+		if quick {
+			command += "_quick"
+		}
+		text += fmt.Sprintf("%s %s\n", command, catalog.Name(hero))
+	}
+
+	return text
+}
+
+// Like " (#3 of 120, top 2.50%)", empty when player is not ranked
+func MakeRankingSuffix(ranking Ranking, err error) string {
+	if err == ErrNotFound {
+		return "\n"
+	}
+	if err != nil {
+		log.Warn(err)
+		return " (error)\n"
+	}
+
+	return fmt.Sprintf(" (%s)\n", ranking)
+}
+
 // Fetch Overwatch profile based on region and BattleTag / PSN ID / Xbox Live Account
 func GetOverwatchProfile(region string, nick string) (*ovrstat.PlayerStats, error) {
-	if region == "eu" || region == "us" || region == "kr" {
-		return ovrstat.PCStats(region, nick)
-	} else if region == "psn" || region == "xbl" {
-		return ovrstat.ConsoleStats(region, nick)
+	if !IsRegion(region) {
+		return nil, errors.New("region is wrong")
+	}
+
+	return provider.GetProfile(region, nick)
+}
+
+// Stats of "CompetitiveStats" or "QuickPlayStats" mode
+func ModeStats(profile *ovrstat.PlayerStats, mode string) ovrstat.StatsCollection {
+	if mode == "QuickPlayStats" {
+		return profile.QuickPlayStats
+	}
+
+	return profile.CompetitiveStats
+}
+
+// Basic competitive counters from allHeroes career stats
+func NewReport(profile *ovrstat.PlayerStats) Report {
+	report := BasicStats(profile.CompetitiveStats)
+	report.Rating = profile.Rating
+	report.Level = profile.Prestige*100 + profile.Level
+
+	return report
+}
+
+// Games, wins, ties and losses from allHeroes career stats of a mode
+func BasicStats(stats ovrstat.StatsCollection) Report {
+	var report Report
+
+	if careerStats, ok := stats.CareerStats["allHeroes"]; ok {
+		if gamesPlayed, ok := careerStats.Game["gamesPlayed"]; ok {
+			report.Games = int(gamesPlayed.(float64))
+		}
+		if gamesWon, ok := careerStats.Game["gamesWon"]; ok {
+			report.Wins = int(gamesWon.(float64))
+		}
+		if gamesTied, ok := careerStats.Game["gamesTied"]; ok {
+			report.Ties = int(gamesTied.(float64))
+		}
+		if gamesLost, ok := careerStats.Game["gamesLost"]; ok {
+			report.Losses = int(gamesLost.(float64))
+		}
+	}
+
+	return report
+}
+
+// Eliminations per death from allHeroes career stats, false when player never died
+func KDRatio(stats ovrstat.StatsCollection) (float64, bool) {
+	careerStats, ok := stats.CareerStats["allHeroes"]
+	if !ok {
+		return 0, false
+	}
+
+	var eliminations, deaths float64
+	if value, ok := careerStats.Combat["eliminations"]; ok {
+		eliminations = value.(float64)
+	}
+	if value, ok := careerStats.Combat["deaths"]; ok {
+		deaths = value.(float64)
+	}
+
+	if deaths == 0 {
+		return 0, false
+	}
+
+	return eliminations / deaths, true
+}
+
+// Stats group of hero career, e.g. "Combat" or "HeroSpecific"
+func CareerGroup(stats ovrstat.StatsCollection, hero string, group string) map[string]interface{} {
+	career, ok := stats.CareerStats[hero]
+	if !ok || career == nil {
+		return nil
+	}
+
+	switch group {
+	case "Assists":
+		return career.Assists
+	case "Average":
+		return career.Average
+	case "Best":
+		return career.Best
+	case "Combat":
+		return career.Combat
+	case "Deaths":
+		return career.Deaths
+	case "HeroSpecific":
+		return career.HeroSpecific
+	case "Game":
+		return career.Game
+	case "MatchAwards":
+		return career.MatchAwards
+	case "Miscellaneous":
+		return career.Miscellaneous
+	}
+
+	return nil
+}
+
+// Counters are float64, percentages come as strings like "35%"
+func NumberValue(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		return number, err == nil
+	}
+
+	return 0, false
+}
+
+// BattleTags are stored with dash instead of hash
+func DisplayNick(user User) string {
+	if IsConsole(user.Region) {
+		return user.Nick
+	}
+
+	return strings.Replace(user.Nick, "-", "#", -1)
+}
+
+func IsConsole(region string) bool {
+	return region == "psn" || region == "xbl"
+}
+
+func IsRegion(region string) bool {
+	return region == "eu" || region == "us" || region == "kr" || IsConsole(region)
+}
+
+func PlatformOf(region string) string {
+	if IsConsole(region) {
+		return "console"
+	}
+
+	return "pc"
+}
+
+// Platform is "pc", "console" or a single region
+func OnPlatform(user User, platform string) bool {
+	switch platform {
+	case "pc", "console":
+		return (platform == "console") == IsConsole(user.Region)
+	}
+
+	return user.Region == platform
+}
+
+func contains(list []string, value string) bool {
+	for _, elem := range list {
+		if elem == value {
+			return true
+		}
 	}
 
-	return nil, errors.New("region is wrong")
+	return false
 }
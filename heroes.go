@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/sdwolfe32/ovrstat/ovrstat"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const heroesPageSize = 10
+
+// Orders of /heroes, the first one is default
+var heroSorts = []string{"time", "winrate", "kd"}
+
+// Heroes with any playtime, ties are broken by playtime
+func SortedHeroes(stats ovrstat.StatsCollection, sortBy string) []string {
+	var heroes []string
+	for name, hero := range stats.TopHeroes {
+		if hero != nil && hero.TimePlayedInSeconds > 0 {
+			heroes = append(heroes, name)
+		}
+	}
+
+	sort.Slice(heroes, func(i, j int) bool {
+		left, right := stats.TopHeroes[heroes[i]], stats.TopHeroes[heroes[j]]
+		switch {
+		case sortBy == "winrate" && left.WinPercentage != right.WinPercentage:
+			return left.WinPercentage > right.WinPercentage
+		case sortBy == "kd" && HeroKD(stats, heroes[i]) != HeroKD(stats, heroes[j]):
+			return HeroKD(stats, heroes[i]) > HeroKD(stats, heroes[j])
+		case left.TimePlayedInSeconds != right.TimePlayedInSeconds:
+			return left.TimePlayedInSeconds > right.TimePlayedInSeconds
+		}
+
+		return heroes[i] < heroes[j]
+	})
+
+	return heroes
+}
+
+// Eliminations per life from hero career, zero when missing
+func HeroKD(stats ovrstat.StatsCollection, hero string) float64 {
+	kd, _ := NumberValue(CareerGroup(stats, hero, "Combat")["eliminationsPerLife"])
+	return kd
+}
+
+func MakeHeroesText(stats ovrstat.StatsCollection, mode string, sortBy string, page int, heroes []string) string {
+	text := fmt.Sprintf("<b>Heroes by %s:</b>\n", sortBy)
+
+	suffix := ""
+	if mode == "QuickPlayStats" {
+		suffix = "_quick"
+	}
+
+	offset := page * heroesPageSize
+	for i, name := range heroes {
+		hero := stats.TopHeroes[name]
+		text += fmt.Sprintf("%d. <b>%s</b> (%s) /h_%s%s\n", offset+i+1, catalog.Name(name), hero.TimePlayed, name, suffix)
+		text += fmt.Sprintf("%d won / %d%% winrate / %0.2f k/d\n", hero.GamesWon, hero.WinPercentage, HeroKD(stats, name))
+	}
+	if len(heroes) == 0 {
+		text += "It's empty..."
+	}
+
+	return text
+}
+
+// Page of sorted heroes and whether there is a next one
+func HeroesPage(stats ovrstat.StatsCollection, sortBy string, page int) ([]string, bool) {
+	heroes := SortedHeroes(stats, sortBy)
+
+	offset := page * heroesPageSize
+	if offset >= len(heroes) {
+		return nil, false
+	}
+	heroes = heroes[offset:]
+
+	more := len(heroes) > heroesPageSize
+	if more {
+		heroes = heroes[:heroesPageSize]
+	}
+
+	return heroes, more
+}
+
+// Prev and Next buttons, nil when everything fits on a single page.
+// Data is "heroes:<quick or empty>:<sort>:<page>".
+func MakeHeroesKeyboard(mode string, sortBy string, page int, more bool) *tgbotapi.InlineKeyboardMarkup {
+	if page == 0 && !more {
+		return nil
+	}
+
+	var quick string
+	if mode == "QuickPlayStats" {
+		quick = "quick"
+	}
+	prefix := fmt.Sprintf("heroes:%s:%s:", quick, sortBy)
+
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("« Prev", fmt.Sprint(prefix, page-1)))
+	}
+	if more {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Next »", fmt.Sprint(prefix, page+1)))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return &keyboard
+}
+
+func HeroesCommand(update tgbotapi.Update, args []string) {
+	mode, sortBy := "CompetitiveStats", heroSorts[0]
+	for _, arg := range args {
+		arg = strings.ToLower(arg)
+		if arg == "quick" {
+			mode = "QuickPlayStats"
+		} else if value := strings.TrimPrefix(arg, "sort="); value != arg && contains(heroSorts, value) {
+			sortBy = value
+		} else {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("<b>Example:</b> <code>/heroes quick sort=%s</code>", strings.Join(heroSorts, "|")))
+			msg.ParseMode = "HTML"
+			bot.Send(msg)
+			return
+		}
+	}
+
+	user, err := store.GetUser(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
+	if err == ErrNotFound {
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Save your profile with /save first.")
+		bot.Send(msg)
+		return
+	}
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	log.Info("/heroes command executed successful")
+
+	stats := ModeStats(user.Profile, mode)
+	heroes, more := HeroesPage(stats, sortBy, 0)
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, MakeHeroesText(stats, mode, sortBy, 0, heroes))
+	msg.ParseMode = "HTML"
+	if keyboard := MakeHeroesKeyboard(mode, sortBy, 0, more); keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	bot.Send(msg)
+}
+
+func HeroesCallback(query *tgbotapi.CallbackQuery, args []string) {
+	if len(args) != 3 || query.Message == nil || !contains(heroSorts, args[1]) {
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	mode := "CompetitiveStats"
+	if args[0] == "quick" {
+		mode = "QuickPlayStats"
+	}
+	sortBy := args[1]
+
+	page, err := strconv.Atoi(args[2])
+	if err != nil || page < 0 {
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	user, err := store.GetUser(fmt.Sprint(dbPKPrefix, query.From.ID))
+	if err == ErrNotFound {
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Save your profile with /save first."))
+		return
+	}
+	if err != nil {
+		log.Warn(err)
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Error, try again later."))
+		return
+	}
+
+	bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+
+	// Profile may be refreshed in between, page is taken from fresh stats
+	stats := ModeStats(user.Profile, mode)
+	heroes, more := HeroesPage(stats, sortBy, page)
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, MakeHeroesText(stats, mode, sortBy, page, heroes))
+	edit.ParseMode = "HTML"
+	edit.ReplyMarkup = MakeHeroesKeyboard(mode, sortBy, page, more)
+	bot.Send(edit)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// History retention rules, can be overridden by HISTORY_* env variables
+// in days ("14d") or Go duration form ("336h").
+// Snapshots younger than FullResolution are kept as is, older ones are
+// downsampled to the last snapshot of each day and deleted after Retention.
+// Zero Retention keeps history forever.
+type HistoryConfig struct {
+	FullResolution time.Duration
+	Retention      time.Duration
+}
+
+func HistoryConfigFromEnv() HistoryConfig {
+	config := HistoryConfig{
+		FullResolution: 14 * 24 * time.Hour,
+		Retention:      365 * 24 * time.Hour,
+	}
+
+	if full := os.Getenv("HISTORY_FULL_RESOLUTION"); full != "" {
+		d, err := ParseHistoryDuration(full)
+		if err != nil {
+			log.Fatalf("HISTORY_FULL_RESOLUTION env variable is wrong: %s", err)
+		}
+		config.FullResolution = d
+	}
+
+	if retention := os.Getenv("HISTORY_RETENTION"); retention != "" {
+		d, err := ParseHistoryDuration(retention)
+		if err != nil {
+			log.Fatalf("HISTORY_RETENTION env variable is wrong: %s", err)
+		}
+		config.Retention = d
+	}
+
+	return config
+}
+
+// Like time.ParseDuration, but also accepts whole days, e.g. "365d"
+func ParseHistoryDuration(s string) (time.Duration, error) {
+	if !strings.HasSuffix(s, "d") {
+		return time.ParseDuration(s)
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+func NewSnapshot(user User) Snapshot {
+	snapshot := Snapshot{
+		User:   user.Id,
+		Date:   user.Date,
+		Report: NewReport(user.Profile),
+		Heroes: make(map[string]HeroSnapshot),
+	}
+
+	for name, hero := range user.Profile.CompetitiveStats.TopHeroes {
+		if hero == nil || hero.TimePlayedInSeconds == 0 {
+			continue
+		}
+
+		snapshot.Heroes[name] = HeroSnapshot{
+			TimePlayed:    hero.TimePlayedInSeconds,
+			GamesWon:      hero.GamesWon,
+			WinPercentage: hero.WinPercentage,
+		}
+	}
+
+	return snapshot
+}
+
+// Same counters and heroes, id and date are ignored
+func (snapshot Snapshot) Same(other Snapshot) bool {
+	snapshot.Id, other.Id = "", ""
+	snapshot.Date, other.Date = time.Time{}, time.Time{}
+
+	return reflect.DeepEqual(snapshot, other)
+}
+
+func RecordSnapshot(user User) {
+	err := store.InsertSnapshot(NewSnapshot(user))
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+// Apply retention rules once a day
+func RunHistoryPruner(config HistoryConfig) {
+	for {
+		PruneHistory(config, time.Now())
+		time.Sleep(24 * time.Hour)
+	}
+}
+
+func PruneHistory(config HistoryConfig, now time.Time) {
+	var from time.Time
+	if config.Retention > 0 {
+		from = now.Add(-config.Retention)
+
+		err := store.DeleteSnapshotsBefore(from)
+		if err != nil {
+			log.Warn(err)
+			return
+		}
+	}
+
+	if config.FullResolution <= 0 {
+		return
+	}
+	to := now.Add(-config.FullResolution)
+
+	users, err := store.GetUsers()
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	var deleted int
+	for _, user := range users {
+		snapshots, err := store.GetSnapshots(user.Id, from, to)
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+
+		// Snapshots are sorted by date, keep the last one of each day
+		var ids []string
+		for i := 0; i < len(snapshots)-1; i++ {
+			if sameDay(snapshots[i].Date, snapshots[i+1].Date) {
+				ids = append(ids, snapshots[i].Id)
+			}
+		}
+
+		if len(ids) == 0 {
+			continue
+		}
+
+		err = store.DeleteSnapshots(ids)
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+		deleted += len(ids)
+	}
+
+	log.Infof("history pruner: %d snapshots downsampled", deleted)
+}
+
+func sameDay(a time.Time, b time.Time) bool {
+	a, b = a.UTC(), b.UTC()
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+var errWrongPeriod = errors.New("history: wrong period")
+
+// SR and game counters over a range of snapshots
+type Progression struct {
+	From  time.Time
+	To    time.Time
+	Start int
+	End   int
+	Peak  int
+	Low   int
+	// Net games, wins, losses and ties, Rating and Level are unused
+	Net Report
+}
+
+func NewProgression(snapshots []Snapshot) Progression {
+	first, last := snapshots[0], snapshots[len(snapshots)-1]
+	progression := Progression{
+		From:  first.Date,
+		To:    last.Date,
+		Start: first.Rating,
+		End:   last.Rating,
+	}
+
+	for i, snapshot := range snapshots {
+		// Zero rating means not placed yet
+		if snapshot.Rating != 0 {
+			if progression.Peak == 0 || snapshot.Rating > progression.Peak {
+				progression.Peak = snapshot.Rating
+			}
+			if progression.Low == 0 || snapshot.Rating < progression.Low {
+				progression.Low = snapshot.Rating
+			}
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		prev := snapshots[i-1]
+		if snapshot.Games < prev.Games {
+			// Season reset, counters start from zero
+			prev.Report = Report{}
+		}
+
+		progression.Net.Games += snapshot.Games - prev.Games
+		progression.Net.Wins += snapshot.Wins - prev.Wins
+		progression.Net.Losses += snapshot.Losses - prev.Losses
+		progression.Net.Ties += snapshot.Ties - prev.Ties
+	}
+
+	return progression
+}
+
+// Seconds played on each hero over a range of snapshots, hero counters
+// are reset every season same as games
+func HeroTimePlayed(snapshots []Snapshot) map[string]int {
+	played := make(map[string]int)
+	for i := 1; i < len(snapshots); i++ {
+		prev, snapshot := snapshots[i-1], snapshots[i]
+		for name, hero := range snapshot.Heroes {
+			diff := hero.TimePlayed - prev.Heroes[name].TimePlayed
+			if snapshot.Games < prev.Games {
+				diff = hero.TimePlayed
+			}
+			if diff > 0 {
+				played[name] += diff
+			}
+		}
+	}
+
+	return played
+}
+
+// Index of the first snapshot of the current season. Competitive
+// counters are reset every season, so it's the last drop of games.
+func SeasonStart(snapshots []Snapshot) int {
+	start := 0
+	for i := 1; i < len(snapshots); i++ {
+		if snapshots[i].Games < snapshots[i-1].Games {
+			start = i
+		}
+	}
+
+	return start
+}
+
+// Snapshots for period like "7d", "30d" or "season"
+func GetPeriodSnapshots(id string, period string, now time.Time) ([]Snapshot, error) {
+	if period == "season" {
+		snapshots, err := store.GetSnapshots(id, time.Time{}, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return snapshots[SeasonStart(snapshots):], nil
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(period, "d"))
+	if err != nil || !strings.HasSuffix(period, "d") || days < 1 {
+		return nil, errWrongPeriod
+	}
+
+	return GetSnapshotsSince(id, now.AddDate(0, 0, -days), now)
+}
+
+// Snapshots in [from, now) preceded by the newest one before from, so
+// games played between it and the first snapshot in period are counted
+func GetSnapshotsSince(id string, from time.Time, now time.Time) ([]Snapshot, error) {
+	snapshots, err := store.GetSnapshots(id, from, now)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline, err := store.GetLastSnapshotBefore(id, from)
+	if err == ErrNotFound {
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]Snapshot{baseline}, snapshots...), nil
+}
+
+func MakeHistorySummary(period string, progression Progression) string {
+	text := fmt.Sprintf("<b>History</b> (%s)\n\n", period)
+
+	text += AddDiffString("Rating", progression.Start, progression.End, progression.End-progression.Start)
+	if progression.Peak != 0 {
+		text += fmt.Sprintf("Peak / Low:\n<code>%d | %d</code>\n", progression.Peak, progression.Low)
+	}
+
+	net := progression.Net
+	text += fmt.Sprintf("Games:\n<code>%d (%d-%d-%d)", net.Games, net.Wins, net.Losses, net.Ties)
+	if net.Games > 0 {
+		text += fmt.Sprintf(" / %0.2f%% winrate", float64(net.Wins)/float64(net.Games)*100)
+	}
+	text += "</code>\n"
+
+	text += fmt.Sprint(
+		"\n<b>Period:</b>\n",
+		progression.From.Format("02.01.2006"), " — ", progression.To.Format("02.01.2006"),
+	)
+
+	return text
+}
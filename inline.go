@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profiles change only on refresh, so repeated keystrokes in inline mode
+// are answered from memory
+const inlineCacheTTL = time.Minute
+
+var inlineCache = NewInlineCache(inlineCacheTTL)
+
+type inlineEntry struct {
+	results []interface{}
+	expires time.Time
+}
+
+// Inline results per user and query
+type InlineCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]inlineEntry
+}
+
+func NewInlineCache(ttl time.Duration) *InlineCache {
+	return &InlineCache{
+		ttl:     ttl,
+		entries: make(map[string]inlineEntry),
+	}
+}
+
+func (c *InlineCache) Get(key string, now time.Time) ([]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.results, true
+}
+
+func (c *InlineCache) Set(key string, results []interface{}, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Expired entries are dropped here, there is no separate janitor
+	for other, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, other)
+		}
+	}
+
+	c.entries[key] = inlineEntry{results: results, expires: now.Add(c.ttl)}
+}
+
+// Articles for "me [quick]", "h hero [quick]" and "top [role]" of saved user
+func MakeInlineResults(user User, query string) ([]interface{}, error) {
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 {
+		fields = []string{"me"}
+	}
+
+	quick := contains(fields[1:], "quick")
+
+	var results []interface{}
+	switch fields[0] {
+	case "me":
+		place, regionPlace, err := GetRatingPlaces(user)
+		if err != nil {
+			return nil, err
+		}
+
+		title := fmt.Sprintf("%s (%d sr)", DisplayNick(user), user.Profile.Rating)
+		if !quick {
+			article := tgbotapi.NewInlineQueryResultArticleHTML("me", title, MakeSummary(user, place, regionPlace, "CompetitiveStats"))
+			article.Description = "Competitive profile summary"
+			results = append(results, article)
+		}
+		article := tgbotapi.NewInlineQueryResultArticleHTML("me_quick", title, MakeSummary(user, place, regionPlace, "QuickPlayStats"))
+		article.Description = "Quick play profile summary"
+		results = append(results, article)
+	case "h":
+		if len(fields) < 2 {
+			return nil, nil
+		}
+
+		mode, description := "CompetitiveStats", "Competitive hero summary"
+		if quick {
+			mode, description = "QuickPlayStats", "Quick play hero summary"
+		}
+
+		// Ambiguous name gives an article for every suggestion
+		hero, heroes := catalog.Resolve(fields[1])
+		if hero != "" {
+			heroes = []string{hero}
+		} else if len(heroes) == 0 {
+			heroes = []string{catalog.Key(fields[1])}
+		}
+
+		for _, hero := range heroes {
+			if _, ok := ModeStats(user.Profile, mode).TopHeroes[hero]; !ok {
+				continue
+			}
+			article := tgbotapi.NewInlineQueryResultArticleHTML("h_"+hero, catalog.Name(hero), MakeHeroSummary(hero, mode, user))
+			article.Description = description
+			results = append(results, article)
+		}
+	case "top":
+		var role string
+		if len(fields) > 1 {
+			role = fields[1]
+			if !IsRole(role) {
+				return nil, nil
+			}
+		}
+
+		platform := PlatformOf(user.Region)
+		top, _, err := GetRatingTopPage(platform, role, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		article := tgbotapi.NewInlineQueryResultArticleHTML("top_"+platform+role, "Rating Top", MakeRatingTopText(platform, role, 0, top))
+		article.Description = fmt.Sprintf("Best %s players", platform)
+		if role != "" {
+			article.Description = fmt.Sprintf("Best %s %s mains", platform, role)
+		}
+		results = append(results, article)
+	}
+
+	return results, nil
+}
+
+func InlineQueryHandler(query *tgbotapi.InlineQuery) {
+	config := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		CacheTime:     int(inlineCacheTTL.Seconds()),
+		IsPersonal:    true,
+	}
+
+	user, err := store.GetUser(fmt.Sprint(dbPKPrefix, query.From.ID))
+	if err == ErrNotFound {
+		config.SwitchPMText = "Save your profile first"
+		config.SwitchPMParameter = "inline"
+		bot.AnswerInlineQuery(config)
+		return
+	}
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	now := time.Now()
+	key := fmt.Sprint(user.Id, ":", strings.Join(strings.Fields(strings.ToLower(query.Query)), " "))
+
+	results, ok := inlineCache.Get(key, now)
+	if !ok {
+		results, err = MakeInlineResults(user, query.Query)
+		if err != nil {
+			log.Warn(err)
+			return
+		}
+		inlineCache.Set(key, results, now)
+	}
+
+	config.Results = results
+	if config.Results == nil {
+		config.Results = []interface{}{}
+	}
+
+	_, err = bot.AnswerInlineQuery(config)
+	if err != nil {
+		log.Warn(err)
+	}
+}
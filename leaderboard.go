@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/sdwolfe32/ovrstat/ovrstat"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Players with less time played are left out of stat leaderboards
+const (
+	minHeroTimePlayed  = 30 * time.Minute
+	minTotalTimePlayed = 3 * time.Hour
+)
+
+const ratingTopPageSize = 20
+
+// Stat for /top, paths are the same GetRank uses after "profile" and mode
+// with hero in between, e.g. "CareerStats", hero, "Combat", "eliminations"
+type TopStat struct {
+	Name  string
+	Title string
+	// Path is divided by Per when it's set
+	Path []string
+	Per  []string
+	// Used instead of Path and Per for a single hero when set
+	HeroPath []string
+	// Value is divided by minutes played
+	PerMinute bool
+	Scale     float64
+	Format    string
+}
+
+var topStats = []TopStat{
+	{Name: "kd", Title: "k/d ratio", Path: []string{"Combat", "eliminations"}, Per: []string{"Combat", "deaths"}, Format: "%0.2f"},
+	{Name: "winrate", Title: "winrate", Path: []string{"Game", "gamesWon"}, Per: []string{"Game", "gamesPlayed"}, HeroPath: []string{"TopHeroes", "WinPercentage"}, Scale: 100, Format: "%0.0f%%"},
+	{Name: "elims", Title: "eliminations per min", Path: []string{"Combat", "eliminations"}, PerMinute: true, Format: "%0.2f"},
+	{Name: "damage", Title: "damage per min", Path: []string{"Combat", "damageDone"}, PerMinute: true, Format: "%0.0f"},
+	{Name: "healing", Title: "healing per min", Path: []string{"Assists", "healingDone"}, PerMinute: true, Format: "%0.0f"},
+	{Name: "blocked", Title: "blocked per min", Path: []string{"Miscellaneous", "damageBlocked"}, PerMinute: true, Format: "%0.0f"},
+	{Name: "objectives", Title: "objective kills per min", Path: []string{"Combat", "objectiveKills"}, PerMinute: true, Format: "%0.2f"},
+	{Name: "crits", Title: "critical hits per min", Path: []string{"Combat", "criticalHits"}, PerMinute: true, Format: "%0.2f"},
+	{Name: "gold", Title: "gold medals", Path: []string{"MatchAwards", "medalsGold"}, Format: "%0.0f"},
+	{Name: "medals", Title: "medals", Path: []string{"MatchAwards", "medals"}, Format: "%0.0f"},
+	{Name: "time", Title: "hours played", Scale: 1.0 / 3600, Format: "%0.1f"},
+}
+
+func FindTopStat(name string) (TopStat, bool) {
+	for _, stat := range topStats {
+		if stat.Name == name {
+			return stat, true
+		}
+	}
+
+	return TopStat{}, false
+}
+
+// Seconds played on hero, or on all heroes for "allHeroes"
+func TimePlayed(stats ovrstat.StatsCollection, hero string) int {
+	if hero != "allHeroes" {
+		if heroStats, ok := stats.TopHeroes[hero]; ok && heroStats != nil {
+			return heroStats.TimePlayedInSeconds
+		}
+		return 0
+	}
+
+	var total int
+	for _, heroStats := range stats.TopHeroes {
+		if heroStats != nil {
+			total += heroStats.TimePlayedInSeconds
+		}
+	}
+
+	return total
+}
+
+// Value of stat for hero, false when player has no such stat
+// or not enough time played
+func (stat TopStat) Value(stats ovrstat.StatsCollection, hero string) (float64, bool) {
+	minTime := minHeroTimePlayed
+	if hero == "allHeroes" {
+		minTime = minTotalTimePlayed
+	}
+	if time.Duration(TimePlayed(stats, hero))*time.Second < minTime {
+		return 0, false
+	}
+
+	return stat.RawValue(stats, hero)
+}
+
+// Same as Value but without playtime threshold
+func (stat TopStat) RawValue(stats ovrstat.StatsCollection, hero string) (float64, bool) {
+	seconds := TimePlayed(stats, hero)
+	if seconds == 0 {
+		return 0, false
+	}
+
+	scale := stat.Scale
+	if scale == 0 {
+		scale = 1
+	}
+
+	if stat.Path == nil {
+		return float64(seconds) * scale, true
+	}
+
+	if hero != "allHeroes" && stat.HeroPath != nil {
+		return lookupNumber(stats, statPath(stat.HeroPath, hero))
+	}
+
+	value, ok := lookupNumber(stats, statPath(append([]string{"CareerStats"}, stat.Path...), hero))
+	if !ok {
+		return 0, false
+	}
+
+	if stat.Per != nil {
+		per, ok := lookupNumber(stats, statPath(append([]string{"CareerStats"}, stat.Per...), hero))
+		if !ok || per == 0 {
+			return 0, false
+		}
+		value /= per
+	}
+
+	if stat.PerMinute {
+		value /= float64(seconds) / 60
+	}
+
+	return value * scale, true
+}
+
+// Put hero after the first path element
+func statPath(path []string, hero string) []string {
+	return append([]string{path[0], hero}, path[1:]...)
+}
+
+// Place of user by stat on hero among candidates, ErrNotFound when
+// user has no such stat or not enough time played
+func StatRanking(stat TopStat, hero string, mode string, user User, candidates []User) (Ranking, error) {
+	value, ok := stat.Value(ModeStats(user.Profile, mode), hero)
+	if !ok {
+		return Ranking{}, ErrNotFound
+	}
+
+	place, population := 1, 0
+	for _, candidate := range candidates {
+		other, ok := stat.Value(ModeStats(candidate.Profile, mode), hero)
+		if !ok {
+			continue
+		}
+
+		population++
+		if other > value {
+			place++
+		}
+	}
+
+	return NewRanking(place, population), nil
+}
+
+type TopEntry struct {
+	User  User
+	Value float64
+}
+
+// Users with profile on platform or region whose competitive main role
+// is role, any role when it's empty
+func GetTopCandidates(platform string, role string, chat int64) ([]User, error) {
+	var (
+		users []User
+		err   error
+	)
+	if chat != 0 {
+		users, err = store.GetChatUsers(chat)
+	} else {
+		users, err = store.GetUsers()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []User
+	for _, user := range users {
+		if user.Profile == nil || !OnPlatform(user, platform) {
+			continue
+		}
+		if role != "" && user.Role != role {
+			continue
+		}
+		candidates = append(candidates, user)
+	}
+
+	return candidates, nil
+}
+
+// Page of rating top and whether there are more pages after it
+func GetRatingTopPage(platform string, role string, chat int64, page int) ([]User, bool, error) {
+	// One extra to know if there is a next page
+	top, err := store.GetRatingTop(platform, role, page*ratingTopPageSize, ratingTopPageSize+1, chat)
+	if err != nil {
+		return nil, false, err
+	}
+
+	more := len(top) > ratingTopPageSize
+	if more {
+		top = top[:ratingTopPageSize]
+	}
+
+	return top, more, nil
+}
+
+func MakeRatingTopText(platform string, role string, page int, top []User) string {
+	text := "<b>Rating Top"
+	if IsRegion(platform) {
+		text += " " + strings.ToUpper(platform)
+	}
+	if role != "" {
+		text += fmt.Sprintf(" (%s mains)", role)
+	}
+	text += ":</b>\n"
+
+	for i, elem := range top {
+		nick := elem.Patreon + DisplayNick(elem)
+		text += fmt.Sprintf("%d. %s (%d)\n", page*ratingTopPageSize+i+1, nick, elem.Profile.Rating)
+	}
+	if len(top) == 0 {
+		text += "It's empty..."
+	}
+
+	return text
+}
+
+// Prev, Next and "Me" buttons, nil when everything fits on a single page.
+// Data is "top:<platform>:<role>:<page or me>", chat is taken from the message.
+func MakeRatingTopKeyboard(platform string, role string, page int, more bool) *tgbotapi.InlineKeyboardMarkup {
+	if page == 0 && !more {
+		return nil
+	}
+
+	prefix := fmt.Sprintf("top:%s:%s:", platform, role)
+
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("« Prev", fmt.Sprint(prefix, page-1)))
+	}
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData("Jump to me", prefix+"me"))
+	if more {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Next »", fmt.Sprint(prefix, page+1)))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return &keyboard
+}
+
+func RatingTopCallback(query *tgbotapi.CallbackQuery, args []string) {
+	if len(args) != 3 || query.Message == nil {
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+	platform, role := args[0], args[1]
+
+	var chatId int64
+	if !query.Message.Chat.IsPrivate() {
+		chatId = query.Message.Chat.ID
+	}
+
+	var page int
+	if args[2] == "me" {
+		offset, err := store.GetRatingTopOffset(fmt.Sprint(dbPKPrefix, query.From.ID), platform, role, chatId)
+		if err == ErrNotFound {
+			bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "You're not in this top."))
+			return
+		}
+		if err != nil {
+			log.Warn(err)
+			bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Error, try again later."))
+			return
+		}
+		page = offset / ratingTopPageSize
+	} else {
+		var err error
+		page, err = strconv.Atoi(args[2])
+		if err != nil || page < 0 {
+			bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+			return
+		}
+	}
+
+	top, more, err := GetRatingTopPage(platform, role, chatId, page)
+	if err != nil {
+		log.Warn(err)
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Error, try again later."))
+		return
+	}
+
+	bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, MakeRatingTopText(platform, role, page, top))
+	edit.ParseMode = "HTML"
+	edit.ReplyMarkup = MakeRatingTopKeyboard(platform, role, page, more)
+	bot.Send(edit)
+}
+
+// Players ordered by stat in descending, hero may be "allHeroes"
+func GetStatTop(stat TopStat, hero string, platform string, role string, limit int, chat int64) ([]TopEntry, error) {
+	users, err := GetTopCandidates(platform, role, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	var top []TopEntry
+	for _, user := range users {
+		value, ok := stat.Value(user.Profile.CompetitiveStats, hero)
+		if !ok {
+			continue
+		}
+		top = append(top, TopEntry{user, value})
+	}
+
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].Value > top[j].Value
+	})
+
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	return top, nil
+}
+
+func MakeStatTopText(stat TopStat, hero string, role string, top []TopEntry) string {
+	text := fmt.Sprintf("<b>Top by %s", stat.Title)
+	if hero != "allHeroes" {
+		text += " on " + html.EscapeString(catalog.Name(hero))
+	}
+	if role != "" {
+		text += fmt.Sprintf(" (%s mains)", role)
+	}
+	text += ":</b>\n"
+
+	for i, elem := range top {
+		nick := elem.User.Patreon + DisplayNick(elem.User)
+		text += fmt.Sprintf("%d. %s (%s)\n", i+1, nick, fmt.Sprintf(stat.Format, elem.Value))
+	}
+	if len(top) == 0 {
+		text += "It's empty..."
+	}
+
+	return text
+}
+
+// Like MakeHeroSuggestions, but for /top which takes hero as argument
+func MakeStatTopSuggestions(stat TopStat, heroes []string) string {
+	text := "Did you mean:\n"
+	for _, hero := range heroes {
+		text += fmt.Sprintf("<code>/top %s %s</code> %s\n", stat.Name, hero, catalog.Name(hero))
+	}
+
+	return text
+}
+
+func TopStatNames() string {
+	var names []string
+	for _, stat := range topStats {
+		names = append(names, stat.Name)
+	}
+
+	return strings.Join(names, "|")
+}
+
+func StatTopCommand(update tgbotapi.Update, args []string) {
+	// Rating top of a single region, e.g. /top eu
+	if region := strings.ToLower(args[0]); IsRegion(region) {
+		RatingTopCommand(update, region, args[1:])
+		return
+	}
+
+	stat, ok := FindTopStat(strings.ToLower(args[0]))
+	if !ok {
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("<b>Stats:</b> <code>%s</code>", TopStatNames()))
+		msg.ParseMode = "HTML"
+		bot.Send(msg)
+		return
+	}
+
+	hero, platform, role := "allHeroes", "pc", ""
+	for _, arg := range args[1:] {
+		if lower := strings.ToLower(arg); lower == "pc" || lower == "console" {
+			platform = lower
+		} else if IsRole(lower) {
+			role = lower
+		} else {
+			key, suggestions := catalog.Resolve(arg)
+			if len(suggestions) > 0 {
+				msg := tgbotapi.NewMessage(update.Message.Chat.ID, MakeStatTopSuggestions(stat, suggestions))
+				msg.ParseMode = "HTML"
+				bot.Send(msg)
+				return
+			}
+			if key == "" {
+				key = arg
+			}
+			hero = key
+		}
+	}
+
+	var chatId int64
+	if !update.Message.Chat.IsPrivate() {
+		chatId = update.Message.Chat.ID
+	}
+
+	top, err := GetStatTop(stat, hero, platform, role, 20, chatId)
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	log.Info("/top command executed successful")
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, MakeStatTopText(stat, hero, role, top))
+	msg.ParseMode = "HTML"
+	bot.Send(msg)
+}
@@ -4,16 +4,18 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/go-telegram-bot-api/telegram-bot-api"
-	r "gopkg.in/gorethink/gorethink.v3"
 	"os"
-	"strings"
+	"sync"
 )
 
 var log = logrus.New()
 
 var (
-	bot        *tgbotapi.BotAPI
-	session    *r.Session
+	bot        Bot
+	router     *Router
+	announcer  *Announcer
+	store      Store
+	provider   StatsProvider
 	dbPKPrefix = "tg:"
 )
 
@@ -23,80 +25,202 @@ func main() {
 
 	var err error
 
-	token := os.Getenv("TOKEN")
-	if token == "" {
-		log.Fatal("TOKEN env variable not specified!")
-	}
-
-	bot, err = tgbotapi.NewBotAPI(token)
+	catalog, err = LoadHeroCatalog(heroCatalogData)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Database pool init
-	go InitConnectionPool()
-
-	// Debug log
-	bot.Debug = false
-
-	log.Infof("authorized on account @%s", bot.Self.UserName)
-
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates, err := bot.GetUpdatesChan(u)
-
-	for update := range updates {
-		if update.Message == nil {
-			continue
+	if os.Getenv("CONSOLE") != "" {
+		bot = NewConsoleBot(os.Stdin, os.Stdout)
+	} else {
+		token := os.Getenv("TOKEN")
+		if token == "" {
+			log.Fatal("TOKEN env variable not specified!")
 		}
 
-		// userId for logger
-		commandLogger := log.WithFields(logrus.Fields{"user_id": update.Message.From.ID})
-
-		if strings.HasPrefix(update.Message.Text, "/setchat") {
-			commandLogger.Info("command /setchat triggered")
-			go SetChatCommand(update)
+		bot, err = NewTelegramBot(token)
+		if err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		if strings.HasPrefix(update.Message.Text, "/consoletop") {
-			commandLogger.Info("command /consoletop triggered")
-			go RatingTopCommand(update, "console")
-		}
+	router = NewRouter()
+	RegisterCommands(router)
 
-		if strings.HasPrefix(update.Message.Text, "/pctop") {
-			commandLogger.Info("command /pctop triggered")
-			go RatingTopCommand(update, "pc")
-		}
+	provider = NewProviderFromEnv()
 
-		// Skip all commands from groups and supergroups
-		if update.Message.Chat.ID != int64(update.Message.From.ID) {
-			continue
-		}
+	announcer = NewAnnouncerFromEnv()
 
-		if strings.HasPrefix(update.Message.Text, "/start") {
-			commandLogger.Info("command /start triggered")
-			go StartCommand(update)
-		}
+	// Storage init
+	store = NewStoreFromEnv()
 
-		if strings.HasPrefix(update.Message.Text, "/donate") {
-			commandLogger.Info("command /donate triggered")
-			go DonateCommand(update)
-		}
+	err = store.WatchProfiles(ProfileChanged)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		if strings.HasPrefix(update.Message.Text, "/save") {
-			commandLogger.Info("command /save triggered")
-			go SaveCommand(update)
-		}
+	go RunRefresher(RefresherConfigFromEnv())
+	go RunHistoryPruner(HistoryConfigFromEnv())
+	go RunDigestScheduler()
 
-		if strings.HasPrefix(update.Message.Text, "/me") {
-			commandLogger.Info("command /me triggered")
-			go MeCommand(update)
-		}
+	log.Infof("authorized on account @%s", bot.UserName())
 
-		if strings.HasPrefix(update.Message.Text, "/h_") {
-			commandLogger.Info("command /h_ triggered")
-			go HeroCommand(update)
-		}
+	updates, err := bot.Updates()
+	if err != nil {
+		log.Fatal(err)
 	}
+
+	// Console input may end, let handlers finish
+	var wg sync.WaitGroup
+	for update := range updates {
+		wg.Add(1)
+		go func(update tgbotapi.Update) {
+			defer wg.Done()
+			HandleUpdate(update)
+		}(update)
+	}
+	wg.Wait()
+}
+
+// Dispatch single update, runs handlers synchronously
+func HandleUpdate(update tgbotapi.Update) {
+	router.Dispatch(update)
+}
+
+func RegisterCommands(router *Router) {
+	router.Register(Command{
+		Name:    "start",
+		MaxArgs: -1,
+		Chats:   PrivateChat,
+		Handler: StartCommand,
+	})
+	router.Register(Command{
+		Name:    "save",
+		Args:    "eu|us|kr|psn|xbl BattleTag#1337|ConsoleLogin",
+		MinArgs: 2,
+		MaxArgs: 2,
+		Chats:   PrivateChat,
+		Help:    "save your game profile",
+		Handler: SaveCommand,
+	})
+	router.Register(Command{
+		Name:    "me",
+		Args:    "[quick]",
+		MaxArgs: 1,
+		Chats:   PrivateChat,
+		Help:    "your profile summary",
+		Handler: MeCommand,
+	})
+	router.Register(Command{
+		Name:    "h",
+		Args:    "hero [quick]",
+		MinArgs: 1,
+		MaxArgs: 2,
+		Chats:   PrivateChat,
+		Help:    "small summary for hero, e.g. /h_ana",
+		Handler: HeroCommand,
+	})
+	router.Register(Command{
+		Name:    "heroes",
+		Args:    "[quick] [sort=time|winrate|kd]",
+		MaxArgs: 2,
+		Chats:   PrivateChat,
+		Help:    "all your played heroes, e.g. /heroes sort=winrate",
+		Handler: HeroesCommand,
+	})
+	router.RegisterCallback("heroes", HeroesCallback)
+	router.Register(Command{
+		Name:    "history",
+		Args:    "[7d|30d|season]",
+		MaxArgs: 1,
+		Chats:   PrivateChat,
+		Help:    "your SR progression over a period",
+		Handler: HistoryCommand,
+	})
+	router.Register(Command{
+		Name:    "chart",
+		Args:    "[7d|30d|season]",
+		MaxArgs: 1,
+		Chats:   AnyChat,
+		Help:    "SR chart, in groups for all its members",
+		Handler: ChartCommand,
+	})
+	router.Register(Command{
+		Name:    "vs",
+		Args:    "@user|eu|us|kr|psn|xbl [BattleTag#1337]",
+		MinArgs: 1,
+		MaxArgs: 2,
+		Chats:   AnyChat,
+		Help:    "compare your profile with another player",
+		Handler: VsCommand,
+	})
+	router.Register(Command{
+		Name:    "hcompare",
+		Args:    "hero hero [quick]",
+		MinArgs: 2,
+		MaxArgs: 3,
+		Chats:   AnyChat,
+		Help:    "compare your stats on two heroes",
+		Handler: HeroCompareCommand,
+	})
+	router.Register(Command{
+		Name:    "settings",
+		Chats:   PrivateChat,
+		Help:    "reports and other preferences",
+		Handler: SettingsCommand,
+	})
+	router.RegisterCallback("settings", SettingsCallback)
+	router.Register(Command{
+		Name:    "pctop",
+		Args:    "[tank|damage|support]",
+		MaxArgs: 1,
+		Chats:   AnyChat,
+		Help:    "PC rating top, in groups only for its members",
+		Handler: func(update tgbotapi.Update, args []string) {
+			RatingTopCommand(update, "pc", args)
+		},
+	})
+	router.Register(Command{
+		Name:    "consoletop",
+		Args:    "[tank|damage|support]",
+		MaxArgs: 1,
+		Chats:   AnyChat,
+		Help:    "console rating top, in groups only for its members",
+		Handler: func(update tgbotapi.Update, args []string) {
+			RatingTopCommand(update, "console", args)
+		},
+	})
+	router.RegisterCallback("top", RatingTopCallback)
+	router.Register(Command{
+		Name:    "top",
+		Args:    "eu|us|kr|psn|xbl|" + TopStatNames() + " [hero|tank|damage|support] [pc|console]",
+		MinArgs: 1,
+		MaxArgs: 3,
+		Chats:   AnyChat,
+		Help:    "top by region or stat, in groups only for its members",
+		Handler: StatTopCommand,
+	})
+	router.Register(Command{
+		Name:    "setchat",
+		Chats:   GroupChat,
+		Help:    "set this group as your primary chat",
+		Handler: SetChatCommand,
+	})
+	router.Register(Command{
+		Name:    "digest",
+		Args:    "off|daily 20:00|weekly mon 20:00",
+		MaxArgs: 3,
+		Chats:   GroupChat,
+		Help:    "show or change schedule of group digest",
+		Handler: DigestCommand,
+	})
+	router.Register(Command{
+		Name:    "donate",
+		Chats:   PrivateChat,
+		Help:    "help me pay server bills",
+		Handler: DonateCommand,
+	})
+
+	// "@OverStatsBot me", "@OverStatsBot h ana" or "@OverStatsBot top" in any chat
+	router.RegisterInline(InlineQueryHandler)
 }
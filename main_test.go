@@ -0,0 +1,461 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Run "go test -update" after intended output changes and review the diff
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata/golden")
+
+// "Last Updated" depends on when profile was saved
+var datePattern = regexp.MustCompile(`\d{2}:\d{2}:\d{2} / \d{2}\.\d{2}\.\d{4} \w+`)
+
+// Fresh bot wired like in main(), profiles come from testdata/<region>/<nick>.json
+func setup(t *testing.T) *FakeBot {
+	fake := NewFakeBot()
+	bot = fake
+	store = NewMemoryStore()
+	provider = FixtureProvider{Dir: "testdata"}
+	inlineCache = NewInlineCache(inlineCacheTTL)
+
+	var err error
+	catalog, err = LoadHeroCatalog(heroCatalogData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router = NewRouter()
+	RegisterCommands(router)
+
+	return fake
+}
+
+// Sends messages to private chat of user and returns replies
+func send(fake *FakeBot, userId int, texts ...string) string {
+	fake.Reset()
+	for _, text := range texts {
+		HandleUpdate(NewFakeUpdate(int64(userId), userId, text))
+	}
+
+	return sentText(fake)
+}
+
+func sentText(fake *FakeBot) string {
+	var replies []string
+	for _, c := range fake.Sent() {
+		replies = append(replies, ChattableText(c))
+	}
+
+	return strings.Join(replies, "\n---\n") + "\n"
+}
+
+func save(t *testing.T, fake *FakeBot, userId int, region string, nick string) {
+	if reply := send(fake, userId, fmt.Sprintf("/save %s %s", region, nick)); reply != "Saved!\n" {
+		t.Fatalf("/save %s %s: %q", region, nick, reply)
+	}
+}
+
+func assertGolden(t *testing.T, name string, got string) {
+	got = datePattern.ReplaceAllString(got, "<date>")
+	path := filepath.Join("testdata", "golden", name+".txt")
+
+	if *updateGolden {
+		err := ioutil.WriteFile(path, []byte(got), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from golden file, got:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestSave(t *testing.T) {
+	fake := setup(t)
+
+	got := send(fake, 1, "/save eu Player#1337", "/save eu Nobody#1", "/save mars Player#1337", "/save eu")
+	assertGolden(t, "save", got)
+
+	user, err := store.GetUser("tg:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Nick != "Player-1337" || user.Region != "eu" || user.Profile.Rating != 2500 {
+		t.Errorf("saved %s %s with %d sr", user.Region, user.Nick, user.Profile.Rating)
+	}
+
+	// Badge is set by hand in database and survives re-saving
+	memory := store.(*MemoryStore)
+	user.Patreon = "⭐️"
+	memory.users[user.Id] = user
+
+	save(t, fake, 1, "eu", "Player#1337")
+	if user, _ := store.GetUser("tg:1"); user.Patreon != "⭐️" {
+		t.Errorf("patreon %q after /save", user.Patreon)
+	}
+}
+
+func TestMe(t *testing.T) {
+	fake := setup(t)
+	save(t, fake, 1, "eu", "Player#1337")
+	save(t, fake, 2, "eu", "Rival#2284")
+	save(t, fake, 3, "us", "Many#1111")
+
+	// Player has less than 7 heroes and only Ana in Quick Play
+	got := send(fake, 1, "/me", "/me_quick")
+	got += "---\n" + send(fake, 3, "/me")
+
+	assertGolden(t, "me", got)
+}
+
+func TestHero(t *testing.T) {
+	fake := setup(t)
+	save(t, fake, 1, "eu", "Player#1337")
+
+	assertGolden(t, "hero", send(fake, 1, "/h_ana", "/h_dva", "/h_ana_quick", "/h_rein_quick", "/h_me"))
+}
+
+func TestPcTop(t *testing.T) {
+	fake := setup(t)
+	save(t, fake, 1, "eu", "Player#1337")
+	save(t, fake, 2, "eu", "Rival#2284")
+	save(t, fake, 3, "us", "Many#1111")
+
+	assertGolden(t, "pctop", send(fake, 1, "/pctop", "/pctop support"))
+}
+
+func TestHeroesPages(t *testing.T) {
+	fake := setup(t)
+	save(t, fake, 3, "us", "Many#1111")
+
+	got := send(fake, 3, "/heroes sort=winrate")
+
+	sent := fake.Sent()
+	msg := sent[len(sent)-1].(tgbotapi.MessageConfig)
+	keyboard, ok := msg.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	if !ok {
+		t.Fatalf("no keyboard on %q", msg.Text)
+	}
+	next := keyboard.InlineKeyboard[0][len(keyboard.InlineKeyboard[0])-1]
+
+	fake.Reset()
+	HandleUpdate(NewFakeCallback(tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: 3, Type: "private"}}, 3, *next.CallbackData))
+	got += "---\n" + sentText(fake)
+
+	assertGolden(t, "heroes", got)
+}
+
+func TestInline(t *testing.T) {
+	fake := setup(t)
+	save(t, fake, 1, "eu", "Player#1337")
+
+	var got string
+	for _, query := range []string{"me", "h ana", "top", "h ana"} {
+		fake.Reset()
+		HandleUpdate(NewFakeInlineQuery(1, query))
+
+		for _, answer := range fake.Answers() {
+			got += fmt.Sprintf("=== %q\n", query)
+			for _, result := range answer.Results {
+				article := result.(tgbotapi.InlineQueryResultArticle)
+				content := article.InputMessageContent.(tgbotapi.InputTextMessageContent)
+				got += fmt.Sprintf("[%s] %s\n%s\n", article.Title, article.Description, content.Text)
+			}
+		}
+	}
+
+	assertGolden(t, "inline", got)
+}
+
+func TestVs(t *testing.T) {
+	fake := setup(t)
+	save(t, fake, 1, "eu", "Player#1337")
+	save(t, fake, 2, "eu", "Rival#2284")
+
+	const group = -100
+	fake.Reset()
+	HandleUpdate(NewFakeUpdate(group, 1, "/setchat"))
+
+	// Username changed after /save, /setchat picks up the new one
+	setchat := NewFakeUpdate(group, 2, "/setchat")
+	setchat.Message.From.UserName = "Rival"
+	HandleUpdate(setchat)
+
+	for _, text := range []string{"/vs @rival", "/vs @user2", "/vs @"} {
+		HandleUpdate(NewFakeUpdate(group, 1, text))
+	}
+
+	assertGolden(t, "vs", sentText(fake))
+}
+
+func TestStatTop(t *testing.T) {
+	fake := setup(t)
+	save(t, fake, 1, "eu", "Player#1337")
+	save(t, fake, 2, "eu", "Rival#2284")
+
+	assertGolden(t, "top", send(fake, 1, "/top kd ana", "/top kd me", "/top kd <i>"))
+}
+
+func TestSettingsMinGames(t *testing.T) {
+	fake := setup(t)
+	save(t, fake, 1, "eu", "Player#1337")
+
+	// "Min games" button cycles through steps and wraps around to "any"
+	var labels []string
+	for i := 0; i <= len(minGamesSteps); i++ {
+		user, err := store.GetUser("tg:1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels = append(labels, MakeSettingsKeyboard(user.Settings).InlineKeyboard[2][0].Text)
+
+		HandleUpdate(NewFakeCallback(tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: 1, Type: "private"}}, 1, "settings:games"))
+	}
+
+	got := strings.Join(labels, ", ")
+	want := "Min games: any, Min games: 1, Min games: 2, Min games: 3, Min games: 5, Min games: 10, Min games: any"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestAnnouncerMergesSessions(t *testing.T) {
+	fake := setup(t)
+	alice := User{Id: "tg:1", Nick: "Alice-1", Region: "eu"}
+	bob := User{Id: "tg:2", Nick: "Bob-2", Region: "eu"}
+
+	a := NewAnnouncer(time.Hour)
+	a.Add(-100, Announcement{User: alice, Diff: Report{Rating: 25, Games: 1, Wins: 1}})
+	a.Add(-100, Announcement{User: bob, Diff: Report{Rating: -20, Games: 1, Losses: 1}})
+	a.Add(-100, Announcement{User: alice, Diff: Report{Rating: 25, Games: 2, Wins: 1, Ties: 1}, QuickWins: 2})
+	a.Flush(-100)
+
+	want := "<b>Sessions:</b>\n<b>Alice#1</b> +50 SR, 2-0-1 (+2 Quick Play wins)\n<b>Bob#2</b> -20 SR, 0-1-0\n"
+	if got := sentText(fake); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDigestLastScheduled(t *testing.T) {
+	// Wednesday
+	now := time.Date(2018, 6, 13, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		digest Digest
+		now    time.Time
+		want   time.Time
+	}{
+		{Digest{Schedule: "daily", Hour: 9, Minute: 30}, now, time.Date(2018, 6, 13, 9, 30, 0, 0, time.UTC)},
+		{Digest{Schedule: "daily", Hour: 12}, now, now},
+		{Digest{Schedule: "daily", Hour: 18}, now, time.Date(2018, 6, 12, 18, 0, 0, 0, time.UTC)},
+		{Digest{Schedule: "weekly", Weekday: time.Wednesday, Hour: 9}, now, time.Date(2018, 6, 13, 9, 0, 0, 0, time.UTC)},
+		{Digest{Schedule: "weekly", Weekday: time.Wednesday, Hour: 18}, now, time.Date(2018, 6, 6, 18, 0, 0, 0, time.UTC)},
+		{Digest{Schedule: "weekly", Weekday: time.Monday, Hour: 18}, now, time.Date(2018, 6, 11, 18, 0, 0, 0, time.UTC)},
+		{Digest{Schedule: "weekly", Weekday: time.Friday, Hour: 9}, now, time.Date(2018, 6, 8, 9, 0, 0, 0, time.UTC)},
+		{Digest{Schedule: "weekly", Weekday: time.Sunday, Hour: 9}, now, time.Date(2018, 6, 10, 9, 0, 0, 0, time.UTC)},
+		// Already Thursday in Moscow, but schedule is in UTC
+		{Digest{Schedule: "daily", Hour: 23}, time.Date(2018, 6, 14, 1, 0, 0, 0, time.FixedZone("MSK", 3*60*60)), time.Date(2018, 6, 12, 23, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		if got := test.digest.LastScheduled(test.now); !got.Equal(test.want) {
+			t.Errorf("%s at %s: got %s, want %s", test.digest, test.now, got, test.want)
+		}
+	}
+}
+
+func TestParseDigestSchedule(t *testing.T) {
+	tests := []struct {
+		args string
+		want Digest
+		err  error
+	}{
+		{"off", Digest{Schedule: "off"}, nil},
+		{"daily 9", Digest{Schedule: "daily", Hour: 9}, nil},
+		{"Daily 21:30", Digest{Schedule: "daily", Hour: 21, Minute: 30}, nil},
+		{"weekly sun 18:05", Digest{Schedule: "weekly", Weekday: time.Sunday, Hour: 18, Minute: 5}, nil},
+		{"weekly Mon 0:00", Digest{Schedule: "weekly", Weekday: time.Monday}, nil},
+		{"daily", Digest{}, errWrongSchedule},
+		{"daily 24:00", Digest{}, errWrongSchedule},
+		{"daily 9:60", Digest{}, errWrongSchedule},
+		{"daily 9 10", Digest{}, errWrongSchedule},
+		{"daily nine", Digest{}, errWrongSchedule},
+		{"weekly 18:00", Digest{}, errWrongSchedule},
+		{"weekly sunday 18:00", Digest{}, errWrongSchedule},
+		{"hourly 9", Digest{}, errWrongSchedule},
+	}
+
+	for _, test := range tests {
+		var got Digest
+		err := ParseDigestSchedule(&got, strings.Fields(test.args))
+		if err != test.err {
+			t.Errorf("%q: got error %v, want %v", test.args, err, test.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.args, got, test.want)
+		}
+	}
+}
+
+func insertSnapshots(t *testing.T, user string, snapshots ...Snapshot) {
+	for _, snapshot := range snapshots {
+		snapshot.User = user
+		if err := store.InsertSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func day(month time.Month, day int, hour int) time.Time {
+	return time.Date(2018, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestHistoryPeriod(t *testing.T) {
+	setup(t)
+	now := day(6, 13, 12)
+
+	// Games between the last snapshot before period and the first one
+	// in period are counted too
+	insertSnapshots(t, "tg:1",
+		Snapshot{Date: day(6, 1, 12), Report: Report{Rating: 2400, Games: 10, Wins: 5, Losses: 5}},
+		Snapshot{Date: day(6, 8, 12), Report: Report{Rating: 2450, Games: 14, Wins: 8, Losses: 6}},
+		Snapshot{Date: day(6, 12, 12), Report: Report{Rating: 2500, Games: 20, Wins: 12, Losses: 8}},
+	)
+
+	snapshots, err := GetPeriodSnapshots("tg:1", "7d", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := NewProgression(snapshots)
+	want := Progression{From: day(6, 1, 12), To: day(6, 12, 12), Start: 2400, End: 2500, Peak: 2500, Low: 2400, Net: Report{Games: 10, Wins: 7, Losses: 3}}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestHistorySeasonReset(t *testing.T) {
+	setup(t)
+	now := day(6, 13, 12)
+
+	// Counters drop to zero in the middle of period and player is unplaced
+	// until placement matches are over
+	insertSnapshots(t, "tg:1",
+		Snapshot{Date: day(6, 1, 12), Report: Report{Rating: 3000, Games: 100, Wins: 50, Losses: 50}},
+		Snapshot{Date: day(6, 8, 12), Report: Report{}},
+		Snapshot{Date: day(6, 10, 12), Report: Report{Rating: 2800, Games: 10, Wins: 6, Losses: 4}},
+		Snapshot{Date: day(6, 12, 12), Report: Report{Rating: 2850, Games: 12, Wins: 8, Losses: 4}},
+	)
+
+	tests := []struct {
+		period string
+		want   Progression
+	}{
+		{"7d", Progression{From: day(6, 1, 12), To: day(6, 12, 12), Start: 3000, End: 2850, Peak: 3000, Low: 2800, Net: Report{Games: 12, Wins: 8, Losses: 4}}},
+		{"season", Progression{From: day(6, 8, 12), To: day(6, 12, 12), Start: 0, End: 2850, Peak: 2850, Low: 2800, Net: Report{Games: 12, Wins: 8, Losses: 4}}},
+	}
+
+	for _, test := range tests {
+		snapshots, err := GetPeriodSnapshots("tg:1", test.period, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := NewProgression(snapshots); got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.period, got, test.want)
+		}
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	setup(t)
+	now := day(6, 30, 12)
+
+	err := store.InsertUser(User{Id: "tg:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insertSnapshots(t, "tg:1",
+		Snapshot{Date: day(6, 1, 12).AddDate(-1, 0, 0)},
+		Snapshot{Date: day(6, 1, 8)},
+		Snapshot{Date: day(6, 1, 20)},
+		Snapshot{Date: day(6, 1, 23)},
+		Snapshot{Date: day(6, 2, 10)},
+		Snapshot{Date: day(6, 25, 9)},
+		Snapshot{Date: day(6, 25, 10)},
+	)
+
+	PruneHistory(HistoryConfig{FullResolution: 14 * 24 * time.Hour, Retention: 365 * 24 * time.Hour}, now)
+
+	snapshots, err := store.GetSnapshots("tg:1", time.Time{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Older than retention is gone, older than full resolution keeps the
+	// last snapshot of each day
+	var got []time.Time
+	for _, snapshot := range snapshots {
+		got = append(got, snapshot.Date)
+	}
+	want := []time.Time{day(6, 1, 23), day(6, 2, 10), day(6, 25, 9), day(6, 25, 10)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSessionReport(t *testing.T) {
+	fake := setup(t)
+
+	// Same player after 3 competitive games and some Quick Play, with
+	// a hero Blizzard returned without stats
+	before, err := provider.GetProfile("eu", "Player-1337")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := provider.GetProfile("eu", "Player-1337-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings Settings
+	}{
+		{"all modes", Settings{}},
+		{"competitive only", Settings{CompetitiveOnly: true}},
+		{"primary group", Settings{ReportsToChat: true}},
+		{"min games", Settings{MinGames: 10}},
+		{"reports off", Settings{DisableReports: true}},
+	}
+
+	var got string
+	for _, test := range tests {
+		user := User{Id: "tg:1", Nick: "Player-1337", Region: "eu", Chat: -100, Settings: test.settings}
+		oldUser, newUser := user, user
+		oldUser.Profile, newUser.Profile = before, after
+
+		fake.Reset()
+		SessionReport(Change{OldVal: oldUser, NewVal: newUser})
+		got += fmt.Sprintf("=== %s\n", test.name) + sentText(fake)
+	}
+
+	assertGolden(t, "session", got)
+}
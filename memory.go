@@ -0,0 +1,492 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store implementation without any database, used for local runs and tests.
+// Watchers are called synchronously from the writing goroutine.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	users    map[string]User
+	history  []Snapshot
+	lastId   int
+	digests  map[int64]Digest
+	watchers []func(Change)
+	maxAge   time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:   make(map[string]User),
+		digests: make(map[int64]Digest),
+		maxAge:  RankingMaxAgeFromEnv(),
+	}
+}
+
+func (s *MemoryStore) WatchProfiles(handler func(Change)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watchers = append(s.watchers, handler)
+	return nil
+}
+
+// Must be called without lock held, handlers may read from the store
+func (s *MemoryStore) notify(change Change) {
+	if !strings.HasPrefix(change.NewVal.Id, dbPKPrefix) {
+		return
+	}
+
+	s.mu.RLock()
+	watchers := append([]func(Change){}, s.watchers...)
+	s.mu.RUnlock()
+
+	for _, handler := range watchers {
+		handler(change)
+	}
+}
+
+func (s *MemoryStore) GetUser(id string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (s *MemoryStore) GetUsers() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []User
+	for id, user := range s.users {
+		if strings.HasPrefix(id, dbPKPrefix) {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+func (s *MemoryStore) GetChatUsers(chat int64) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []User
+	for _, user := range s.users {
+		if user.Chat == chat {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// All users ordered by rating in descending, same as rating index
+func (s *MemoryStore) byRating() []User {
+	var users []User
+	for _, user := range s.users {
+		if user.Profile != nil {
+			users = append(users, user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Profile.Rating > users[j].Profile.Rating
+	})
+
+	return users
+}
+
+// Users of platform, and of chat when it's set, ordered by rating
+func (s *MemoryStore) ratingTop(platform string, role string, chat int64) []User {
+	var top []User
+	for _, user := range s.byRating() {
+		if !OnPlatform(user, platform) {
+			continue
+		}
+		if role != "" && user.Role != role {
+			continue
+		}
+		if chat != 0 && user.Chat != chat {
+			continue
+		}
+		top = append(top, user)
+	}
+
+	return top
+}
+
+func (s *MemoryStore) GetRatingTop(platform string, role string, offset int, limit int, chat int64) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	top := s.ratingTop(platform, role, chat)
+	if offset >= len(top) {
+		return nil, nil
+	}
+
+	top = top[offset:]
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	return top, nil
+}
+
+func (s *MemoryStore) GetRatingTopOffset(id string, platform string, role string, chat int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i, user := range s.ratingTop(platform, role, chat) {
+		if user.Id == id {
+			return i, nil
+		}
+	}
+
+	return 0, ErrNotFound
+}
+
+func (s *MemoryStore) GetRatingPlace(id string, region string) (Ranking, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return Ranking{}, ErrNotFound
+	}
+
+	platform := region
+	if platform == "" {
+		platform = PlatformOf(user.Region)
+	}
+
+	now := time.Now()
+	var population []User
+	for _, elem := range s.byRating() {
+		if elem.Profile.Rating > 0 && OnPlatform(elem, platform) && IsRanked(elem, s.maxAge, now) {
+			population = append(population, elem)
+		}
+	}
+
+	for i, elem := range population {
+		if elem.Id == id {
+			return NewRanking(i+1, len(population)), nil
+		}
+	}
+
+	return Ranking{}, ErrNotFound
+}
+
+func (s *MemoryStore) GetRank(id string, path ...string) (Ranking, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return Ranking{}, ErrNotFound
+	}
+
+	type entry struct {
+		id    string
+		value float64
+	}
+
+	now := time.Now()
+	var entries []entry
+	for _, elem := range s.users {
+		if !OnPlatform(elem, PlatformOf(user.Region)) || !IsRanked(elem, s.maxAge, now) {
+			continue
+		}
+
+		value, ok := lookupNumber(elem, path)
+		if !ok || value <= 0 {
+			continue
+		}
+		entries = append(entries, entry{elem.Id, value})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].value > entries[j].value
+	})
+
+	for i, e := range entries {
+		if e.id == id {
+			return NewRanking(i+1, len(entries)), nil
+		}
+	}
+
+	return Ranking{}, ErrNotFound
+}
+
+func (s *MemoryStore) InsertUser(user User) error {
+	s.mu.Lock()
+	old := s.users[user.Id]
+	newUser := User{
+		Id:       user.Id,
+		Profile:  user.Profile,
+		Nick:     user.Nick,
+		Region:   user.Region,
+		Chat:     user.Chat,
+		Settings: user.Settings,
+		Username: user.Username,
+		Patreon:  user.Patreon,
+		Role:     MainRoleOf(user.Profile),
+		Date:     time.Now(),
+	}
+	s.users[user.Id] = newUser
+	s.mu.Unlock()
+
+	s.notify(Change{OldVal: old, NewVal: newUser})
+	return nil
+}
+
+func (s *MemoryStore) UpdateUser(user User) (bool, error) {
+	s.mu.Lock()
+	old, ok := s.users[user.Id]
+	if !ok {
+		s.mu.Unlock()
+		return false, ErrNotFound
+	}
+	if old.Chat == user.Chat && old.Username == user.Username {
+		s.mu.Unlock()
+		return false, nil
+	}
+
+	newUser := old
+	newUser.Chat = user.Chat
+	newUser.Username = user.Username
+	s.users[user.Id] = newUser
+	s.mu.Unlock()
+
+	s.notify(Change{OldVal: old, NewVal: newUser})
+	return true, nil
+}
+
+func (s *MemoryStore) UpdateProfile(user User) error {
+	s.mu.Lock()
+	old, ok := s.users[user.Id]
+	if !ok {
+		s.mu.Unlock()
+		return ErrNotFound
+	}
+
+	newUser := old
+	newUser.Profile = user.Profile
+	newUser.Role = MainRoleOf(user.Profile)
+	newUser.Date = time.Now()
+	s.users[user.Id] = newUser
+	s.mu.Unlock()
+
+	s.notify(Change{OldVal: old, NewVal: newUser})
+	return nil
+}
+
+func (s *MemoryStore) UpdateSettings(id string, settings Settings) error {
+	s.mu.Lock()
+	old, ok := s.users[id]
+	if !ok {
+		s.mu.Unlock()
+		return ErrNotFound
+	}
+
+	newUser := old
+	newUser.Settings = settings
+	s.users[id] = newUser
+	s.mu.Unlock()
+
+	s.notify(Change{OldVal: old, NewVal: newUser})
+	return nil
+}
+
+func (s *MemoryStore) InsertSnapshot(snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastId++
+	snapshot.Id = strconv.Itoa(s.lastId)
+	s.history = append(s.history, snapshot)
+	return nil
+}
+
+func (s *MemoryStore) GetSnapshots(user string, from time.Time, to time.Time) ([]Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var snapshots []Snapshot
+	for _, snapshot := range s.history {
+		if snapshot.User == user && !snapshot.Date.Before(from) && snapshot.Date.Before(to) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Date.Before(snapshots[j].Date)
+	})
+
+	return snapshots, nil
+}
+
+func (s *MemoryStore) GetLastSnapshotBefore(user string, date time.Time) (Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		last  Snapshot
+		found bool
+	)
+	for _, snapshot := range s.history {
+		if snapshot.User == user && snapshot.Date.Before(date) && (!found || snapshot.Date.After(last.Date)) {
+			last, found = snapshot, true
+		}
+	}
+
+	if !found {
+		return Snapshot{}, ErrNotFound
+	}
+
+	return last, nil
+}
+
+func (s *MemoryStore) DeleteSnapshots(ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.history[:0]
+	for _, snapshot := range s.history {
+		if !contains(ids, snapshot.Id) {
+			history = append(history, snapshot)
+		}
+	}
+	s.history = history
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteSnapshotsBefore(date time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.history[:0]
+	for _, snapshot := range s.history {
+		if !snapshot.Date.Before(date) {
+			history = append(history, snapshot)
+		}
+	}
+	s.history = history
+
+	return nil
+}
+
+func (s *MemoryStore) GetDigestChats() ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var chats []int64
+	for _, user := range s.users {
+		if user.Chat != 0 && !containsChat(chats, user.Chat) {
+			chats = append(chats, user.Chat)
+		}
+	}
+
+	return chats, nil
+}
+
+func (s *MemoryStore) GetDigest(chat int64) (Digest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	digest, ok := s.digests[chat]
+	if !ok {
+		return Digest{}, ErrNotFound
+	}
+
+	return digest, nil
+}
+
+func (s *MemoryStore) SaveDigest(digest Digest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.digests[digest.Chat] = digest
+	return nil
+}
+
+func containsChat(chats []int64, chat int64) bool {
+	for _, elem := range chats {
+		if elem == chat {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve a document path the same way RethinkDB sees it: gorethink tags
+// for our structs, Go field names for ovrstat ones and keys for maps
+func lookupNumber(value interface{}, path []string) (float64, bool) {
+	v := reflect.ValueOf(value)
+	for _, field := range path {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return 0, false
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			v = structField(v, field)
+		case reflect.Map:
+			v = v.MapIndex(reflect.ValueOf(field))
+		default:
+			return 0, false
+		}
+
+		if !v.IsValid() {
+			return 0, false
+		}
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return 0, false
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		// Percentages like weaponAccuracy come as strings
+		number, err := strconv.ParseFloat(strings.TrimSuffix(v.String(), "%"), 64)
+		return number, err == nil
+	}
+
+	return 0, false
+}
+
+func structField(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("gorethink"), ",")[0]
+		if tag == name || (tag == "" && t.Field(i).Name == name) {
+			return v.Field(i)
+		}
+	}
+
+	return reflect.Value{}
+}
@@ -3,52 +3,43 @@ package main
 import (
 	"fmt"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/sdwolfe32/ovrstat/ovrstat"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-func SessionReport(change Change) {
-	// Check OldVal and NewOld existing
-	if change.OldVal.Profile != nil && change.NewVal.Profile != nil {
-		oldStats := Report{
-			Rating: change.OldVal.Profile.Rating,
-			Level:  change.OldVal.Profile.Prestige*100 + change.OldVal.Profile.Level,
+// Called for every change in users table
+func ProfileChanged(change Change) {
+	// Date is bumped on every refresh, snapshot only when stats moved
+	if change.NewVal.Profile != nil && !change.NewVal.Date.Equal(change.OldVal.Date) {
+		if change.OldVal.Profile == nil || !NewSnapshot(change.OldVal).Same(NewSnapshot(change.NewVal)) {
+			RecordSnapshot(change.NewVal)
 		}
+	}
 
-		if competitiveStats, ok := change.OldVal.Profile.CompetitiveStats.CareerStats["allHeroes"]; ok {
-			if gamesPlayed, ok := competitiveStats.Game["gamesPlayed"]; ok {
-				oldStats.Games = int(gamesPlayed.(float64))
-			}
-			if gamesWon, ok := competitiveStats.Game["gamesWon"]; ok {
-				oldStats.Wins = int(gamesWon.(float64))
-			}
-			if gamesTied, ok := competitiveStats.Game["gamesTied"]; ok {
-				oldStats.Ties = int(gamesTied.(float64))
-			}
-			if gamesLost, ok := competitiveStats.Game["gamesLost"]; ok {
-				oldStats.Losses = int(gamesLost.(float64))
-			}
-		}
+	SessionReport(change)
+}
 
-		newStats := Report{
-			Rating: change.NewVal.Profile.Rating,
-			Level:  change.NewVal.Profile.Prestige*100 + change.NewVal.Profile.Level,
-		}
+// Line like "Rating:\n2500 | 2525 | +25 📈" used by reports
+func AddDiffString(name string, oldInfo int, newInfo int, diffInfo int) string {
+	text := fmt.Sprintf("%s:\n<code>%d | %d |", name, oldInfo, newInfo)
+	if diffInfo > 0 {
+		text += fmt.Sprintf(" +%d 📈\n</code>", diffInfo)
+	} else if diffInfo == 0 {
+		text += fmt.Sprintf(" %d —\n</code>", diffInfo)
+	} else {
+		text += fmt.Sprintf(" %d 📉\n</code>", diffInfo)
+	}
 
-		if competitiveStats, ok := change.NewVal.Profile.CompetitiveStats.CareerStats["allHeroes"]; ok {
-			if gamesPlayed, ok := competitiveStats.Game["gamesPlayed"]; ok {
-				newStats.Games = int(gamesPlayed.(float64))
-			}
-			if gamesWon, ok := competitiveStats.Game["gamesWon"]; ok {
-				newStats.Wins = int(gamesWon.(float64))
-			}
-			if gamesTied, ok := competitiveStats.Game["gamesTied"]; ok {
-				newStats.Ties = int(gamesTied.(float64))
-			}
-			if gamesLost, ok := competitiveStats.Game["gamesLost"]; ok {
-				newStats.Losses = int(gamesLost.(float64))
-			}
-		}
+	return text
+}
+
+func SessionReport(change Change) {
+	// Check OldVal and NewOld existing
+	if change.OldVal.Profile != nil && change.NewVal.Profile != nil {
+		oldStats := NewReport(change.OldVal.Profile)
+		newStats := NewReport(change.NewVal.Profile)
 
 		diffStats := Report{
 			newStats.Rating - oldStats.Rating,
@@ -59,33 +50,173 @@ func SessionReport(change Change) {
 			newStats.Losses - oldStats.Losses,
 		}
 
-		AddDiffString := func(name string, oldInfo int, newInfo int, diffInfo int) string {
-			text := fmt.Sprintf("%s:\n<code>%d | %d |", name, oldInfo, newInfo)
-			if diffInfo > 0 {
-				text += fmt.Sprintf(" +%d 📈\n</code>", diffInfo)
-			} else if diffInfo == 0 {
-				text += fmt.Sprintf(" %d —\n</code>", diffInfo)
-			} else {
-				text += fmt.Sprintf(" %d 📉\n</code>", diffInfo)
+		oldQuick := NewQuickReport(change.OldVal.Profile.QuickPlayStats)
+		newQuick := NewQuickReport(change.NewVal.Profile.QuickPlayStats)
+
+		settings := change.NewVal.Settings
+		competitiveChanged := diffStats.Games > 0 || diffStats.Rating != 0
+		quickChanged := !settings.CompetitiveOnly && (newQuick.TimePlayed > oldQuick.TimePlayed || newQuick.Wins > oldQuick.Wins)
+
+		// Quick Play doesn't count played games, so only wins count there
+		games := diffStats.Games
+		if quickChanged {
+			games += newQuick.Wins - oldQuick.Wins
+		}
+
+		if games < settings.MinGames {
+			return
+		}
+
+		// Full report in the group already says it all
+		reportInGroup := settings.ReportsToChat && !settings.DisableReports
+		if settings.Announce && !reportInGroup && change.NewVal.Chat != 0 && (competitiveChanged || quickChanged) {
+			var quickWins int
+			if quickChanged {
+				quickWins = newQuick.Wins - oldQuick.Wins
 			}
+			announcer.Add(change.NewVal.Chat, Announcement{User: change.NewVal, Diff: diffStats, QuickWins: quickWins})
+		}
 
-			return text
+		if settings.DisableReports {
+			return
 		}
 
-		if diffStats.Games > 0 || diffStats.Level != 0 {
+		if competitiveChanged || quickChanged || (diffStats.Level != 0 && !settings.CompetitiveOnly) {
 			log.Infof("sending report to %s", change.NewVal.Id)
 			text := "<b>Session Report</b>\n\n"
 
-			text += AddDiffString("Rating", oldStats.Rating, newStats.Rating, diffStats.Rating)
-			text += AddDiffString("Wins", oldStats.Wins, newStats.Wins, diffStats.Wins)
-			text += AddDiffString("Losses", oldStats.Losses, newStats.Losses, diffStats.Losses)
-			text += AddDiffString("Ties", oldStats.Ties, newStats.Ties, diffStats.Ties)
+			if competitiveChanged {
+				text += "<b>Competitive</b>\n"
+				text += AddDiffString("Rating", oldStats.Rating, newStats.Rating, diffStats.Rating)
+				text += AddDiffString("Wins", oldStats.Wins, newStats.Wins, diffStats.Wins)
+				text += AddDiffString("Losses", oldStats.Losses, newStats.Losses, diffStats.Losses)
+				text += AddDiffString("Ties", oldStats.Ties, newStats.Ties, diffStats.Ties)
+
+				heroes := DiffHeroes(change.OldVal.Profile.CompetitiveStats, change.NewVal.Profile.CompetitiveStats)
+				if len(heroes) > 0 {
+					text += "\n<b>Heroes:</b>\n"
+					for _, hero := range heroes {
+						text += hero.String()
+					}
+				}
+				text += "\n"
+			}
+
+			if quickChanged {
+				text += fmt.Sprintf("<b>Quick Play</b> (%d min)\n", (newQuick.TimePlayed-oldQuick.TimePlayed+30)/60)
+				text += AddDiffString("Wins", oldQuick.Wins, newQuick.Wins, newQuick.Wins-oldQuick.Wins)
+				text += AddDiffString("Eliminations", oldQuick.Eliminations, newQuick.Eliminations, newQuick.Eliminations-oldQuick.Eliminations)
+				text += AddDiffString("Deaths", oldQuick.Deaths, newQuick.Deaths, newQuick.Deaths-oldQuick.Deaths)
+				text += AddDiffString("Medals", oldQuick.Medals, newQuick.Medals, newQuick.Medals-oldQuick.Medals)
+				text += "\n"
+			}
+
 			text += AddDiffString("Level", oldStats.Level, newStats.Level, diffStats.Level)
 
 			id, _ := strconv.ParseInt(strings.Split(change.NewVal.Id, ":")[1], 10, 64)
+			if settings.ReportsToChat && change.NewVal.Chat != 0 {
+				id = change.NewVal.Chat
+				text = fmt.Sprintf("<b>%s</b>\n", DisplayNick(change.NewVal)) + text
+			}
+
 			msg := tgbotapi.NewMessage(id, text)
 			msg.ParseMode = "HTML"
 			bot.Send(msg)
 		}
 	}
 }
+
+// Quick Play counters from allHeroes career stats
+type QuickReport struct {
+	Wins         int
+	TimePlayed   int
+	Eliminations int
+	Deaths       int
+	Medals       int
+}
+
+func NewQuickReport(stats ovrstat.StatsCollection) QuickReport {
+	var report QuickReport
+
+	// Career time played is a string like "42 hours", top heroes have seconds
+	for _, hero := range stats.TopHeroes {
+		if hero != nil {
+			report.TimePlayed += hero.TimePlayedInSeconds
+		}
+	}
+
+	value := func(group string, key string) int {
+		number, _ := NumberValue(CareerGroup(stats, "allHeroes", group)[key])
+		return int(number)
+	}
+
+	report.Wins = value("Game", "gamesWon")
+	report.Eliminations = value("Combat", "eliminations")
+	report.Deaths = value("Combat", "deaths")
+	report.Medals = value("MatchAwards", "medals")
+
+	return report
+}
+
+// What was done on a hero between two profiles
+type HeroSession struct {
+	Name         string
+	TimePlayed   int
+	GamesPlayed  int
+	GamesWon     int
+	Eliminations float64
+	DamageDone   float64
+}
+
+func (hero HeroSession) String() string {
+	text := fmt.Sprintf("<b>%s</b> %d min", catalog.Name(hero.Name), (hero.TimePlayed+30)/60)
+	if hero.GamesPlayed > 0 {
+		text += fmt.Sprintf(" / %d of %d won", hero.GamesWon, hero.GamesPlayed)
+	} else if hero.GamesWon > 0 {
+		text += fmt.Sprintf(" / %d won", hero.GamesWon)
+	}
+
+	minutes := float64(hero.TimePlayed) / 60
+	text += fmt.Sprintf("\n<code>%0.2f elims | %0.0f dmg per min</code>\n", hero.Eliminations/minutes, hero.DamageDone/minutes)
+
+	return text
+}
+
+// Heroes played between two profiles, most played first
+func DiffHeroes(oldStats ovrstat.StatsCollection, newStats ovrstat.StatsCollection) []HeroSession {
+	var heroes []HeroSession
+	for name, hero := range newStats.TopHeroes {
+		if hero == nil {
+			continue
+		}
+
+		timePlayed := hero.TimePlayedInSeconds
+		if oldHero, ok := oldStats.TopHeroes[name]; ok && oldHero != nil {
+			timePlayed -= oldHero.TimePlayedInSeconds
+		}
+		if timePlayed <= 0 {
+			continue
+		}
+
+		diff := func(group string, key string) float64 {
+			newValue, _ := NumberValue(CareerGroup(newStats, name, group)[key])
+			oldValue, _ := NumberValue(CareerGroup(oldStats, name, group)[key])
+			return newValue - oldValue
+		}
+
+		heroes = append(heroes, HeroSession{
+			Name:         name,
+			TimePlayed:   timePlayed,
+			GamesPlayed:  int(diff("Game", "gamesPlayed")),
+			GamesWon:     int(diff("Game", "gamesWon")),
+			Eliminations: diff("Combat", "eliminations"),
+			DamageDone:   diff("Combat", "damageDone"),
+		})
+	}
+
+	sort.Slice(heroes, func(i, j int) bool {
+		return heroes[i].TimePlayed > heroes[j].TimePlayed
+	})
+
+	return heroes
+}
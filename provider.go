@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sdwolfe32/ovrstat/ovrstat"
+	"os"
+	"path/filepath"
+)
+
+// Source of Overwatch profiles, region is already validated
+type StatsProvider interface {
+	GetProfile(region string, nick string) (*ovrstat.PlayerStats, error)
+}
+
+// Pick stats source based on FIXTURES env variable
+func NewProviderFromEnv() StatsProvider {
+	if dir := os.Getenv("FIXTURES"); dir != "" {
+		log.Warnf("loading profiles from %s instead of Blizzard", dir)
+		return FixtureProvider{Dir: dir}
+	}
+
+	return OvrstatProvider{}
+}
+
+// Scrapes playoverwatch.com
+type OvrstatProvider struct{}
+
+func (OvrstatProvider) GetProfile(region string, nick string) (*ovrstat.PlayerStats, error) {
+	if IsConsole(region) {
+		return ovrstat.ConsoleStats(region, nick)
+	}
+
+	return ovrstat.PCStats(region, nick)
+}
+
+// Reads recorded ovrstat JSON responses from <Dir>/<region>/<nick>.json,
+// where nick is already stored form, e.g. eu/Player-1337.json
+type FixtureProvider struct {
+	Dir string
+}
+
+func (p FixtureProvider) GetProfile(region string, nick string) (*ovrstat.PlayerStats, error) {
+	// Nick comes straight from chat, don't let it escape the directory
+	if nick != filepath.Base(nick) || nick == ".." {
+		return nil, errors.New("fixtures: bad nick")
+	}
+
+	file, err := os.Open(filepath.Join(p.Dir, region, nick+".json"))
+	if os.IsNotExist(err) {
+		return nil, errors.New("fixtures: player not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var profile ovrstat.PlayerStats
+	err = json.NewDecoder(file).Decode(&profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
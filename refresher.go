@@ -0,0 +1,124 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Refresher settings, can be overridden by REFRESH_* env variables
+type RefresherConfig struct {
+	Interval time.Duration
+	Workers  int
+	Jitter   time.Duration
+}
+
+func RefresherConfigFromEnv() RefresherConfig {
+	config := RefresherConfig{
+		Interval: 15 * time.Minute,
+		Workers:  4,
+		Jitter:   30 * time.Second,
+	}
+
+	if interval := os.Getenv("REFRESH_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("REFRESH_INTERVAL env variable is wrong: %s", err)
+		}
+		config.Interval = d
+	}
+
+	if workers := os.Getenv("REFRESH_WORKERS"); workers != "" {
+		n, err := strconv.Atoi(workers)
+		if err != nil || n < 1 {
+			log.Fatal("REFRESH_WORKERS env variable should be a positive number")
+		}
+		config.Workers = n
+	}
+
+	if jitter := os.Getenv("REFRESH_JITTER"); jitter != "" {
+		d, err := time.ParseDuration(jitter)
+		if err != nil {
+			log.Fatalf("REFRESH_JITTER env variable is wrong: %s", err)
+		}
+		config.Jitter = d
+	}
+
+	return config
+}
+
+// Periodically re-fetch every saved profile, zero interval disables it
+func RunRefresher(config RefresherConfig) {
+	if config.Interval <= 0 {
+		log.Info("profile refresher disabled")
+		return
+	}
+
+	log.Infof("profile refresher started (every %s, %d workers)", config.Interval, config.Workers)
+
+	for {
+		time.Sleep(config.Interval + randomDuration(config.Jitter))
+		RefreshProfiles(config)
+	}
+}
+
+// Single pass over the users table
+func RefreshProfiles(config RefresherConfig) {
+	users, err := store.GetUsers()
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, config.Workers)
+
+	for _, user := range users {
+		if user.Region == "" || user.Nick == "" {
+			continue
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(user User) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			// Spread requests so we don't hammer Blizzard all at once
+			time.Sleep(randomDuration(config.Jitter))
+			RefreshProfile(user)
+		}(user)
+	}
+
+	wg.Wait()
+	log.Infof("profile refresher: %d users processed", len(users))
+}
+
+func RefreshProfile(user User) {
+	userLogger := log.WithFields(logrus.Fields{"user_id": user.Id})
+
+	profile, err := GetOverwatchProfile(user.Region, user.Nick)
+	if err != nil {
+		userLogger.Warn(err)
+		return
+	}
+
+	user.Profile = profile
+	err = store.UpdateProfile(user)
+	if err != nil {
+		userLogger.Warn(err)
+	}
+}
+
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
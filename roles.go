@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sdwolfe32/ovrstat/ovrstat"
+	"sort"
+	"strings"
+)
+
+var roles = []string{"tank", "damage", "support"}
+
+func IsRole(value string) bool {
+	for _, role := range roles {
+		if role == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Share of time played on each role, from 0 to 1
+type RoleSplit map[string]float64
+
+func NewRoleSplit(stats ovrstat.StatsCollection) RoleSplit {
+	split := make(RoleSplit)
+
+	var total float64
+	for name, hero := range stats.TopHeroes {
+		// Heroes missing in catalog are not counted
+		role := catalog.Role(name)
+		if role == "" || hero == nil {
+			continue
+		}
+
+		split[role] += float64(hero.TimePlayedInSeconds)
+		total += float64(hero.TimePlayedInSeconds)
+	}
+
+	if total == 0 {
+		return RoleSplit{}
+	}
+	for role := range split {
+		split[role] /= total
+	}
+
+	return split
+}
+
+// Competitive main role of profile, empty without profile
+func MainRoleOf(profile *ovrstat.PlayerStats) string {
+	if profile == nil {
+		return ""
+	}
+
+	return NewRoleSplit(profile.CompetitiveStats).MainRole()
+}
+
+// Most played role, empty when nothing played
+func (split RoleSplit) MainRole() string {
+	var main string
+	for _, role := range roles {
+		if split[role] > split[main] {
+			main = role
+		}
+	}
+
+	return main
+}
+
+// Like "62% support / 30% tank / 8% damage"
+func (split RoleSplit) String() string {
+	ordered := append([]string{}, roles...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return split[ordered[i]] > split[ordered[j]]
+	})
+
+	var parts []string
+	for _, role := range ordered {
+		percent := split[role] * 100
+		if percent < 1 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%0.0f%% %s", percent, role))
+	}
+
+	return strings.Join(parts, " / ")
+}
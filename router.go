@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+type ChatScope int
+
+const (
+	PrivateChat ChatScope = 1 << iota
+	GroupChat
+	AnyChat = PrivateChat | GroupChat
+)
+
+type CommandHandler func(update tgbotapi.Update, args []string)
+
+// Called for inline queries like "@OverStatsBot me" typed in any chat
+type InlineHandler func(query *tgbotapi.InlineQuery)
+
+// Called for inline button presses, data "settings:games" gives args ["games"]
+type CallbackHandler func(query *tgbotapi.CallbackQuery, args []string)
+
+type Command struct {
+	// Without slash, e.g. "save"
+	Name string
+	// Argument spec shown in help and usage, e.g. "eu|us|kr|psn|xbl BattleTag#1337"
+	Args string
+	// Bounds for argument count, MaxArgs -1 means unlimited
+	MinArgs int
+	MaxArgs int
+	Chats   ChatScope
+	// Command is hidden from /start when empty
+	Help    string
+	Handler CommandHandler
+}
+
+type Router struct {
+	commands  map[string]*Command
+	order     []*Command
+	callbacks map[string]CallbackHandler
+	inline    InlineHandler
+}
+
+func NewRouter() *Router {
+	return &Router{
+		commands:  make(map[string]*Command),
+		callbacks: make(map[string]CallbackHandler),
+	}
+}
+
+func (router *Router) Register(command Command) {
+	if _, ok := router.commands[command.Name]; ok {
+		log.Fatalf("command /%s registered twice", command.Name)
+	}
+
+	router.commands[command.Name] = &command
+	router.order = append(router.order, &command)
+}
+
+func (router *Router) RegisterCallback(prefix string, handler CallbackHandler) {
+	if _, ok := router.callbacks[prefix]; ok {
+		log.Fatalf("callback %s registered twice", prefix)
+	}
+
+	router.callbacks[prefix] = handler
+}
+
+func (router *Router) RegisterInline(handler InlineHandler) {
+	if router.inline != nil {
+		log.Fatal("inline handler registered twice")
+	}
+
+	router.inline = handler
+}
+
+// Split "/h_ana_quick@OverStatsBot more args" into name "h", bot name
+// "OverStatsBot" and args ["ana", "quick", "more", "args"]. Underscore parts
+// of the command itself are arguments, so /h_ana and /h ana are the same.
+func ParseCommand(text string) (name string, botName string, args []string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") || len(fields[0]) == 1 {
+		return "", "", nil, false
+	}
+
+	command := fields[0][1:]
+	if i := strings.Index(command, "@"); i != -1 {
+		command, botName = command[:i], command[i+1:]
+	}
+
+	parts := strings.Split(command, "_")
+	for _, part := range parts[1:] {
+		if part != "" {
+			args = append(args, part)
+		}
+	}
+	args = append(args, fields[1:]...)
+
+	return strings.ToLower(parts[0]), botName, args, true
+}
+
+func (router *Router) Dispatch(update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		router.dispatchCallback(update.CallbackQuery)
+		return
+	}
+
+	if update.InlineQuery != nil {
+		router.dispatchInline(update.InlineQuery)
+		return
+	}
+
+	if update.Message == nil {
+		return
+	}
+
+	name, botName, args, ok := ParseCommand(update.Message.Text)
+	if !ok {
+		return
+	}
+
+	// Addressed to another bot in the same group
+	if botName != "" && !strings.EqualFold(botName, bot.UserName()) {
+		return
+	}
+
+	// Groups may have other bots with their own commands, so there we
+	// answer only if someone explicitly mentioned us
+	private := update.Message.Chat.IsPrivate()
+	explicit := private || botName != ""
+
+	command, ok := router.commands[name]
+	if !ok {
+		if explicit {
+			router.reply(update, "Unknown command, see /start for the list.")
+		}
+		return
+	}
+
+	if private && command.Chats&PrivateChat == 0 {
+		router.reply(update, fmt.Sprintf("/%s works only in groups.", command.Name))
+		return
+	}
+	if !private && command.Chats&GroupChat == 0 {
+		if explicit {
+			router.reply(update, fmt.Sprintf("/%s works only in private chat with @%s.", command.Name, bot.UserName()))
+		}
+		return
+	}
+
+	if len(args) < command.MinArgs || (command.MaxArgs >= 0 && len(args) > command.MaxArgs) {
+		router.reply(update, fmt.Sprintf("<b>Example:</b> <code>/%s %s</code>", command.Name, command.Args))
+		return
+	}
+
+	// userId for logger
+	log.WithFields(logrus.Fields{"user_id": update.Message.From.ID}).Infof("command /%s triggered", command.Name)
+	command.Handler(update, args)
+}
+
+func (router *Router) dispatchCallback(query *tgbotapi.CallbackQuery) {
+	parts := strings.Split(query.Data, ":")
+
+	handler, ok := router.callbacks[parts[0]]
+	if !ok {
+		log.Warnf("unknown callback %q", query.Data)
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	// userId for logger
+	log.WithFields(logrus.Fields{"user_id": query.From.ID}).Infof("callback %s triggered", parts[0])
+	handler(query, parts[1:])
+}
+
+func (router *Router) dispatchInline(query *tgbotapi.InlineQuery) {
+	// Inline mode may be enabled in BotFather before handler is deployed
+	if router.inline == nil {
+		return
+	}
+
+	// userId for logger
+	log.WithFields(logrus.Fields{"user_id": query.From.ID}).Infof("inline query %q triggered", query.Query)
+	router.inline(query)
+}
+
+// Help lines for commands available in given chats
+func (router *Router) Help(chats ChatScope) string {
+	var text string
+	for _, command := range router.order {
+		if command.Help == "" || command.Chats&chats == 0 {
+			continue
+		}
+
+		text += "/" + command.Name
+		if command.Args != "" {
+			text += fmt.Sprintf(" <code>%s</code>", command.Args)
+		}
+		text += fmt.Sprintf(" — %s\n", command.Help)
+	}
+
+	return text
+}
+
+func (router *Router) reply(update tgbotapi.Update, text string) {
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	msg.ParseMode = "HTML"
+	bot.Send(msg)
+}
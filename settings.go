@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Values offered by "Min games" button, pressing it picks the next one.
+// Zero reports any change, even sessions without finished games.
+var minGamesSteps = []int{0, 1, 2, 3, 5, 10}
+
+func MakeSettingsText() string {
+	text := "<b>Settings</b>\n\n"
+	text += "<b>Reports</b> — session report after you played\n"
+	text += "<b>Modes</b> — include Quick Play or only Competitive\n"
+	text += "<b>Min games</b> — skip sessions with fewer games\n"
+	text += "<b>Deliver to</b> — this chat or primary group set by /setchat\n"
+	text += "<b>Announce</b> — short summary like \"+25 SR, 2-1-0\" in primary group\n"
+
+	return text
+}
+
+func MakeSettingsKeyboard(settings Settings) tgbotapi.InlineKeyboardMarkup {
+	reports := "on ✅"
+	if settings.DisableReports {
+		reports = "off ❌"
+	}
+
+	modes := "all"
+	if settings.CompetitiveOnly {
+		modes = "competitive only"
+	}
+
+	minGames := fmt.Sprint(settings.MinGames)
+	if settings.MinGames == 0 {
+		minGames = "any"
+	}
+
+	deliver := "private chat"
+	if settings.ReportsToChat {
+		deliver = "primary group"
+	}
+
+	announce := "off"
+	if settings.Announce {
+		announce = "on"
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Reports: "+reports, "settings:reports")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Modes: "+modes, "settings:modes")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Min games: "+minGames, "settings:games")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Deliver to: "+deliver, "settings:deliver")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Announce in group: "+announce, "settings:announce")),
+	)
+}
+
+func SettingsCommand(update tgbotapi.Update, args []string) {
+	user, err := store.GetUser(fmt.Sprint(dbPKPrefix, update.Message.From.ID))
+	if err == ErrNotFound {
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Save your profile with /save first.")
+		bot.Send(msg)
+		return
+	}
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	log.Info("/settings command executed successful")
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, MakeSettingsText())
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = MakeSettingsKeyboard(user.Settings)
+	bot.Send(msg)
+}
+
+func SettingsCallback(query *tgbotapi.CallbackQuery, args []string) {
+	user, err := store.GetUser(fmt.Sprint(dbPKPrefix, query.From.ID))
+	if err != nil {
+		log.Warn(err)
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Save your profile with /save first."))
+		return
+	}
+
+	var action string
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	settings := user.Settings
+	switch action {
+	case "reports":
+		settings.DisableReports = !settings.DisableReports
+	case "modes":
+		settings.CompetitiveOnly = !settings.CompetitiveOnly
+	case "games":
+		next := minGamesSteps[0]
+		for _, step := range minGamesSteps {
+			if step > settings.MinGames {
+				next = step
+				break
+			}
+		}
+		settings.MinGames = next
+	case "deliver":
+		if !settings.ReportsToChat && user.Chat == 0 {
+			bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Set your primary group with /setchat first."))
+			return
+		}
+		settings.ReportsToChat = !settings.ReportsToChat
+	case "announce":
+		if !settings.Announce && user.Chat == 0 {
+			bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Set your primary group with /setchat first."))
+			return
+		}
+		settings.Announce = !settings.Announce
+	default:
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	err = store.UpdateSettings(user.Id, settings)
+	if err != nil {
+		log.Warn(err)
+		bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Error, try again later."))
+		return
+	}
+
+	bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Saved!"))
+
+	keyboard := MakeSettingsKeyboard(settings)
+	edit := tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, keyboard)
+	bot.Send(edit)
+}
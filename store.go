@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var ErrNotFound = errors.New("db: row not found")
+
+// Storage backend used by commands, notifications and the refresher
+type Store interface {
+	GetUser(id string) (User, error)
+	GetUsers() ([]User, error)
+	// Users who set chat as primary with /setchat
+	GetChatUsers(chat int64) ([]User, error)
+	// Platform is "pc", "console" or a single region like "eu" or "psn",
+	// empty role is any main role
+	GetRatingTop(platform string, role string, offset int, limit int, chat int64) ([]User, error)
+	// Index of user in the same list GetRatingTop pages through
+	GetRatingTopOffset(id string, platform string, role string, chat int64) (int, error)
+	// Place among placed users of the same platform, or only among users
+	// of region when it's set. ErrNotFound if user itself is not ranked.
+	GetRatingPlace(id string, region string) (Ranking, error)
+	// Path is a list of document fields, e.g. "profile", "CompetitiveStats", "TopHeroes", "ana", "WinPercentage".
+	// Only users of the same platform with positive value are ranked.
+	GetRank(id string, path ...string) (Ranking, error)
+	// Replaces the whole document, callers carry over fields to keep
+	InsertUser(user User) error
+	// Sets primary chat and refreshes username, reports false if both
+	// were already set
+	UpdateUser(user User) (bool, error)
+	UpdateProfile(user User) error
+	UpdateSettings(id string, settings Settings) error
+	InsertSnapshot(snapshot Snapshot) error
+	// Snapshots of user in [from, to) ordered by date
+	GetSnapshots(user string, from time.Time, to time.Time) ([]Snapshot, error)
+	// Newest snapshot of user before date, ErrNotFound when there is none
+	GetLastSnapshotBefore(user string, date time.Time) (Snapshot, error)
+	DeleteSnapshots(ids []string) error
+	DeleteSnapshotsBefore(date time.Time) error
+	// Distinct primary chats of all users
+	GetDigestChats() ([]int64, error)
+	GetDigest(chat int64) (Digest, error)
+	// Inserts or replaces digest of the chat
+	SaveDigest(digest Digest) error
+	// Subscribes handler to every change of a tg: user, doesn't block
+	WatchProfiles(handler func(Change)) error
+}
+
+// Pick storage backend based on STORE env variable
+func NewStoreFromEnv() Store {
+	switch os.Getenv("STORE") {
+	case "", "rethinkdb":
+		return NewRethinkStore()
+	case "memory":
+		log.Warn("using in-memory store, nothing will be persisted")
+		return NewMemoryStore()
+	}
+
+	log.Fatal("STORE env variable should be rethinkdb or memory")
+	return nil
+}
+
+// Users not refreshed for longer than RANKING_MAX_AGE are left out of
+// rankings, zero keeps everyone
+func RankingMaxAgeFromEnv() time.Duration {
+	maxAge := os.Getenv("RANKING_MAX_AGE")
+	if maxAge == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(maxAge)
+	if err != nil {
+		log.Fatalf("RANKING_MAX_AGE env variable is wrong: %s", err)
+	}
+
+	return d
+}
+
+// Whether user is counted in rankings with given max age
+func IsRanked(user User, maxAge time.Duration, now time.Time) bool {
+	if user.Profile == nil {
+		return false
+	}
+
+	return maxAge == 0 || now.Sub(user.Date) <= maxAge
+}
+
+func NewRanking(place int, population int) Ranking {
+	return Ranking{
+		Place:      place,
+		Population: population,
+		Percentile: float64(place) / float64(population) * 100,
+	}
+}
+
+func (ranking Ranking) String() string {
+	return fmt.Sprintf("#%d of %d, top %0.2f%%", ranking.Place, ranking.Population, ranking.Percentile)
+}
@@ -6,13 +6,30 @@ import (
 )
 
 type User struct {
-	Id      string               `gorethink:"id"`
-	Profile *ovrstat.PlayerStats `gorethink:"profile"`
-	Nick    string               `gorethink:"nick"`
-	Region  string               `gorethink:"region"`
-	Date    time.Time            `gorethink:"date"`
-	Chat    int64                `gorethink:"chat"`
-	Patreon string               `gorethink:"patreon"`
+	Id       string               `gorethink:"id"`
+	Profile  *ovrstat.PlayerStats `gorethink:"profile"`
+	Nick     string               `gorethink:"nick"`
+	Region   string               `gorethink:"region"`
+	Date     time.Time            `gorethink:"date"`
+	Chat     int64                `gorethink:"chat"`
+	Patreon  string               `gorethink:"patreon"`
+	Settings Settings             `gorethink:"settings"`
+	// Telegram username without @, for /vs
+	Username string `gorethink:"username"`
+	// Competitive main role, written by store with every profile
+	Role string `gorethink:"role"`
+}
+
+// Zero value is the default behaviour for users who never opened /settings
+type Settings struct {
+	DisableReports  bool `gorethink:"disable_reports"`
+	CompetitiveOnly bool `gorethink:"competitive_only"`
+	// Minimum games in session, zero means any
+	MinGames int `gorethink:"min_games"`
+	// Send reports to primary group set by /setchat
+	ReportsToChat bool `gorethink:"reports_to_chat"`
+	// Post short summary to primary group
+	Announce bool `gorethink:"announce"`
 }
 
 type Change struct {
@@ -29,7 +46,39 @@ type Report struct {
 	Losses int `gorethink:"losses"`
 }
 
-type Top struct {
-	Place int     `gorethink:"place"`
-	Rank  float64 `gorethink:"rank"`
+// Position of a player among comparable players: same platform, placed
+// or having the stat, and refreshed recently
+type Ranking struct {
+	Place      int `gorethink:"place"`
+	Population int `gorethink:"population"`
+	// Share of population at or above the player, 1% is the best one of a hundred
+	Percentile float64 `gorethink:"percentile"`
+}
+
+// Compact profile state kept in history table
+type Snapshot struct {
+	Id     string                  `gorethink:"id,omitempty"`
+	User   string                  `gorethink:"user"`
+	Date   time.Time               `gorethink:"date"`
+	Report                         // competitive allHeroes counters
+	Heroes map[string]HeroSnapshot `gorethink:"heroes"`
+}
+
+type HeroSnapshot struct {
+	TimePlayed    int `gorethink:"time_played"`
+	GamesWon      int `gorethink:"games_won"`
+	WinPercentage int `gorethink:"win_percentage"`
+}
+
+// Digest schedule and state of a group chat, kept in chats table
+type Digest struct {
+	Chat int64 `gorethink:"id"`
+	// "daily", "weekly" or "off", times are in UTC
+	Schedule string       `gorethink:"schedule"`
+	Weekday  time.Weekday `gorethink:"weekday"`
+	Hour     int          `gorethink:"hour"`
+	Minute   int          `gorethink:"minute"`
+	LastSent time.Time    `gorethink:"last_sent"`
+	// Places in rating top at the moment of last digest, by user id
+	Standings map[string]int `gorethink:"standings"`
 }
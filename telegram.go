@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Everything handlers need from Telegram, so they can run against FakeBot
+type Bot interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
+	AnswerInlineQuery(config tgbotapi.InlineConfig) (tgbotapi.APIResponse, error)
+	Updates() (<-chan tgbotapi.Update, error)
+	UserName() string
+}
+
+type TelegramBot struct {
+	api *tgbotapi.BotAPI
+}
+
+func NewTelegramBot(token string) (*TelegramBot, error) {
+	api, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Debug log
+	api.Debug = false
+
+	return &TelegramBot{api: api}, nil
+}
+
+func (b *TelegramBot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return b.api.Send(c)
+}
+
+func (b *TelegramBot) AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	return b.api.AnswerCallbackQuery(config)
+}
+
+func (b *TelegramBot) AnswerInlineQuery(config tgbotapi.InlineConfig) (tgbotapi.APIResponse, error) {
+	return b.api.AnswerInlineQuery(config)
+}
+
+func (b *TelegramBot) Updates() (<-chan tgbotapi.Update, error) {
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	return b.api.GetUpdatesChan(u)
+}
+
+func (b *TelegramBot) UserName() string {
+	return b.api.Self.UserName
+}